@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	_types "github.com/zishang520/engine.io-go-parser/types"
+)
+
+// handshakeOpenPacket is a minimal OPEN payload with heartbeats far enough
+// out that they never interfere with a short-lived test.
+const handshakeOpenPacket = `0{"sid":"hung-peer","upgrades":[],"pingInterval":300000,"pingTimeout":300000,"maxPayload":1000000}`
+
+// TestCloseContextDeadlineHungPollingPeer opens a session against a polling
+// peer that answers the handshake and then goes silent. With a POST stuck
+// behind the hung peer, CloseContext must still return within its deadline.
+func TestCloseContextDeadlineHungPollingPeer(t *testing.T) {
+	var handshaken atomic.Bool
+	hang := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handshaken.CompareAndSwap(false, true) {
+			w.Write([]byte(handshakeOpenPacket))
+			return
+		}
+		<-hang
+	}))
+	t.Cleanup(func() {
+		close(hang)
+		ts.Close()
+	})
+
+	s := openSocket(t, ts.URL, pollingOnly())
+
+	// This batch POSTs into the void and never drains.
+	s.Send(_types.NewStringBufferString("stuck"), nil, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	err := s.CloseContext(ctx)
+	elapsed := time.Since(started)
+
+	if err == nil {
+		t.Error("CloseContext returned nil although the close had to be forced")
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("CloseContext took %v, deadline was 300ms", elapsed)
+	}
+	if got := s.ReadyState(); got != SocketStateClosed {
+		t.Errorf("socket state after forced close = %q, want closed", got)
+	}
+}
+
+// TestCloseContextDeadlineHungWebsocketPeer wedges the websocket transport:
+// the peer completes the handshake and then stops reading, so big writes
+// eventually block on the TCP window. CloseContext must not block with them.
+func TestCloseContextDeadlineHungWebsocketPeer(t *testing.T) {
+	upgrader := ws.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	hang := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(ws.TextMessage, []byte(handshakeOpenPacket))
+		<-hang // never read another frame
+	}))
+	t.Cleanup(func() {
+		close(hang)
+		ts.Close()
+	})
+
+	s := openSocket(t, ts.URL, websocketOnly())
+
+	// Fill the peer's unread TCP window until a write blocks for good.
+	// Each packet stays under the advertised maxPayload so none is rejected
+	// client-side; together they exceed any plausible socket buffering.
+	payload := make([]byte, 500_000)
+	for i := 0; i < 100; i++ {
+		s.SendBytes(payload)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	err := s.CloseContext(ctx)
+	elapsed := time.Since(started)
+
+	if err == nil {
+		t.Error("CloseContext returned nil although the close had to be forced")
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("CloseContext took %v, deadline was 300ms", elapsed)
+	}
+	if got := s.ReadyState(); got != SocketStateClosed {
+		t.Errorf("socket state after forced close = %q, want closed", got)
+	}
+}
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"errors"
+
+	_types "github.com/zishang520/engine.io-go-parser/types"
+)
+
+// PayloadCodec compresses application MESSAGE payloads independently of the
+// transport, so the same codec works over polling, websocket and
+// webtransport. The codec is advertised to the server through the "codec"
+// query parameter and only becomes active when the handshake echoes its name
+// back; otherwise payloads pass through untouched.
+type PayloadCodec interface {
+	// Name identifies the codec during negotiation ("zstd", ...).
+	Name() string
+
+	Compress([]byte) ([]byte, error)
+	Decompress([]byte) ([]byte, error)
+}
+
+// codecQueryParam carries the offered codec name during the handshake.
+const codecQueryParam = "codec"
+
+// Markers prefixing every MESSAGE payload once a codec is negotiated, so the
+// receiver can tell compressed from raw and restore the original string or
+// binary flavor of the payload.
+const (
+	codecMarkerRawBinary        byte = 0x00
+	codecMarkerRawString        byte = 0x01
+	codecMarkerCompressedBinary byte = 0x02
+	codecMarkerCompressedString byte = 0x03
+)
+
+// encodeCodecPayload frames data for the negotiated codec, compressing it
+// when it reaches the configured threshold.
+func encodeCodecPayload(codec PayloadCodec, threshold int, data _types.BufferInterface) (_types.BufferInterface, error) {
+	_, isString := data.(*_types.StringBuffer)
+	raw := data.Bytes()
+
+	marker := codecMarkerRawBinary
+	if isString {
+		marker = codecMarkerRawString
+	}
+
+	body := raw
+	if len(raw) >= threshold {
+		compressed, err := codec.Compress(raw)
+		if err != nil {
+			return nil, err
+		}
+		body = compressed
+		if isString {
+			marker = codecMarkerCompressedString
+		} else {
+			marker = codecMarkerCompressedBinary
+		}
+	}
+
+	framed := make([]byte, 1+len(body))
+	framed[0] = marker
+	copy(framed[1:], body)
+
+	return _types.NewBytesBuffer(framed), nil
+}
+
+// decodeCodecPayload undoes encodeCodecPayload on the receive path.
+func decodeCodecPayload(codec PayloadCodec, data _types.BufferInterface) (_types.BufferInterface, error) {
+	framed := data.Bytes()
+	if len(framed) == 0 {
+		return data, nil
+	}
+
+	body := framed[1:]
+
+	switch framed[0] {
+	case codecMarkerRawBinary:
+		return _types.NewBytesBuffer(body), nil
+	case codecMarkerRawString:
+		return _types.NewStringBufferString(string(body)), nil
+	case codecMarkerCompressedBinary:
+		raw, err := codec.Decompress(body)
+		if err != nil {
+			return nil, err
+		}
+		return _types.NewBytesBuffer(raw), nil
+	case codecMarkerCompressedString:
+		raw, err := codec.Decompress(body)
+		if err != nil {
+			return nil, err
+		}
+		return _types.NewStringBufferString(string(raw)), nil
+	}
+
+	return nil, errors.New("unknown payload codec marker")
+}
@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	_types "github.com/zishang520/engine.io-go-parser/types"
+)
+
+// xorCodec is a trivial reversible codec: enough to prove the framing picks
+// the right marker and actually calls Compress/Decompress.
+type xorCodec struct {
+	compressed   int
+	decompressed int
+}
+
+func (c *xorCodec) Name() string { return "xor" }
+
+func (c *xorCodec) Compress(data []byte) ([]byte, error) {
+	c.compressed++
+	return c.flip(data), nil
+}
+
+func (c *xorCodec) Decompress(data []byte) ([]byte, error) {
+	c.decompressed++
+	return c.flip(data), nil
+}
+
+func (c *xorCodec) flip(data []byte) []byte {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[i] = b ^ 0x5A
+	}
+	return out
+}
+
+// TestCodecPayloadRoundTrip encodes and decodes both payload flavors above
+// the threshold and checks the original bytes and type come back.
+func TestCodecPayloadRoundTrip(t *testing.T) {
+	codec := &xorCodec{}
+
+	for _, tc := range []struct {
+		name    string
+		payload _types.BufferInterface
+		wantStr bool
+	}{
+		{"string", _types.NewStringBufferString(strings.Repeat("compress me ", 16)), true},
+		{"binary", _types.NewBytesBuffer(bytes.Repeat([]byte{0xDE, 0xAD}, 64)), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			original := append([]byte(nil), tc.payload.Bytes()...)
+
+			framed, err := encodeCodecPayload(codec, 1, tc.payload)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			if bytes.Contains(framed.Bytes(), original) {
+				t.Errorf("framed payload still contains the plaintext")
+			}
+
+			decoded, err := decodeCodecPayload(codec, framed)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if !bytes.Equal(decoded.Bytes(), original) {
+				t.Errorf("round trip mangled the payload")
+			}
+			if _, isString := decoded.(*_types.StringBuffer); isString != tc.wantStr {
+				t.Errorf("round trip changed the payload flavor: string=%v, want %v", isString, tc.wantStr)
+			}
+		})
+	}
+
+	if codec.compressed != 2 || codec.decompressed != 2 {
+		t.Errorf("codec calls: compressed=%d decompressed=%d, want 2 each", codec.compressed, codec.decompressed)
+	}
+}
+
+// TestCodecPayloadThreshold checks payloads below the threshold skip the
+// codec but still round-trip through the raw markers.
+func TestCodecPayloadThreshold(t *testing.T) {
+	codec := &xorCodec{}
+	payload := _types.NewStringBufferString("tiny")
+
+	framed, err := encodeCodecPayload(codec, len("tiny")+1, payload)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if codec.compressed != 0 {
+		t.Errorf("sub-threshold payload was compressed")
+	}
+	if framed.Bytes()[0] != codecMarkerRawString {
+		t.Errorf("marker = %#x, want raw string", framed.Bytes()[0])
+	}
+
+	decoded, err := decodeCodecPayload(codec, framed)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if decoded.String() != "tiny" || codec.decompressed != 0 {
+		t.Errorf("raw payload did not pass through untouched")
+	}
+
+	// Exactly at the threshold compression must kick in.
+	framed, err = encodeCodecPayload(codec, len("tiny"), payload)
+	if err != nil {
+		t.Fatalf("encode at threshold: %v", err)
+	}
+	if codec.compressed != 1 {
+		t.Errorf("at-threshold payload was not compressed")
+	}
+	if framed.Bytes()[0] != codecMarkerCompressedString {
+		t.Errorf("marker = %#x, want compressed string", framed.Bytes()[0])
+	}
+}
@@ -0,0 +1,185 @@
+package engine
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_types "github.com/zishang520/engine.io-go-parser/types"
+)
+
+// TestExtraHeadersFnPerRequest checks the dynamic header callback is invoked
+// for every polling request - not snapshotted once - and that its values win
+// over the static ExtraHeaders. Run with -race, the callback fires from the
+// poll and write goroutines concurrently.
+func TestExtraHeadersFnPerRequest(t *testing.T) {
+	url := newTestServer(t, nil)
+
+	var calls atomic.Int64
+	opts := pollingOnly()
+	opts.SetExtraHeaders(http.Header{"X-Token": {"stale"}})
+	opts.SetExtraHeadersFn(func() http.Header {
+		n := calls.Add(1)
+		return http.Header{"X-Token": {"fresh-" + strconv.FormatInt(n, 10)}}
+	})
+
+	s := openSocket(t, url, opts)
+	echoRound(t, s, 3)
+
+	// Handshake GET, long polls and write POSTs each consult the callback.
+	if got := calls.Load(); got < 3 {
+		t.Errorf("ExtraHeadersFn called %d times across several requests", got)
+	}
+
+	// The merge itself: dynamic beats static, the User-Agent rides on top.
+	headers := requestHeaders(s.Opts())
+	if got := headers.Get("X-Token"); got == "stale" || got == "" {
+		t.Errorf("X-Token = %q, want the callback's value", got)
+	}
+	if headers.Get("User-Agent") == "" {
+		t.Errorf("User-Agent missing from the assembled headers")
+	}
+}
+
+// TestRequestHeadersConcurrent hammers the header assembly from many
+// goroutines; the callback contract says it may be called concurrently, and
+// -race holds the function to it.
+func TestRequestHeadersConcurrent(t *testing.T) {
+	var calls atomic.Int64
+	opts := DefaultSocketOptions()
+	opts.SetExtraHeaders(http.Header{"X-Static": {"s"}})
+	opts.SetExtraHeadersFn(func() http.Header {
+		return http.Header{"X-Dynamic": {strconv.FormatInt(calls.Add(1), 10)}}
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				headers := requestHeaders(opts)
+				if headers.Get("X-Static") == "" || headers.Get("X-Dynamic") == "" {
+					t.Error("assembled headers missing a source")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestPublicSurfaceConcurrentStress exercises the documented-thread-safe
+// surface (see the package comment's concurrency section) from many
+// goroutines against a live server while the transport is being refreshed
+// underneath. It asserts nothing beyond "no race, no panic, still closes" -
+// which is the contract. Run with -race to give it teeth.
+func TestPublicSurfaceConcurrentStress(t *testing.T) {
+	url := newTestServer(t, nil)
+	s := openSocket(t, url, websocketOnly())
+
+	stop := time.After(1500 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		<-stop
+		close(done)
+	}()
+
+	running := func() bool {
+		select {
+		case <-done:
+			return false
+		default:
+			return true
+		}
+	}
+
+	var wg sync.WaitGroup
+	spawn := func(fn func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for running() {
+				fn()
+			}
+		}()
+	}
+
+	// The write surface.
+	spawn(func() { s.Send(_types.NewStringBufferString("stress"), nil, func() {}) })
+	spawn(func() { s.SendString("stress-string") })
+	spawn(func() { s.SendBytes([]byte{0x01, 0x02}) })
+	spawn(func() { s.SendVolatile(_types.NewStringBufferString("volatile"), nil, nil) })
+	spawn(func() { s.WriteWithResult(_types.NewStringBufferString("result"), nil, func(error) {}) })
+	spawn(func() { s.TrySend(_types.NewStringBufferString("try"), nil, nil) })
+	spawn(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		s.WaitForDrain(ctx)
+		cancel()
+	})
+
+	// Getters and instrumentation.
+	spawn(func() {
+		s.Id()
+		s.ReadyState()
+		s.TransportName()
+		s.WriteBufferLen()
+		s.BufferedAmount()
+		s.PendingPackets()
+		s.Upgrading()
+		s.Generation()
+		s.DroppedPackets()
+		s.HasPingExpired()
+	})
+	spawn(func() {
+		s.Stats()
+		s.PacketCounts()
+		s.ConnectTimings()
+		s.LastRTT()
+		s.AvgRTT()
+		s.ConnectionPath()
+		s.Handshake()
+		s.PingInterval()
+		s.PingTimeout()
+	})
+	spawn(func() {
+		s.Upgrades()
+		s.AvailableUpgrades()
+		s.AbortUpgrade()
+		s.ProbeUpgrade("websocket") // already active; the error is the point
+	})
+
+	// Event registration.
+	spawn(func() {
+		listener := func(...any) {}
+		s.On(EventPacket, listener)
+		s.RemoveListener(EventPacket, listener)
+		wildcard := AnyListener(func(string, ...any) {})
+		s.OnAny(wildcard)
+		s.OffAny(wildcard)
+	})
+	spawn(func() {
+		s.OnStateChange(func(SocketState, SocketState) {})
+		s.OnClosed(func(error) {})
+	})
+
+	// Lifecycle churn underneath all of the above.
+	spawn(func() {
+		s.RefreshTransport()
+		time.Sleep(50 * time.Millisecond)
+	})
+	spawn(func() {
+		s.Flush()
+		s.ClearCookies()
+		time.Sleep(5 * time.Millisecond)
+	})
+
+	wg.Wait()
+
+	s.Close()
+	waitForClosed(t, s, 10*time.Second)
+}
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zishang520/engine.io-go-parser/packet"
+	_types "github.com/zishang520/engine.io-go-parser/types"
+)
+
+// TestWriteCallbackBeforeDrain pins the documented ordering: a batch's write
+// callbacks fire after the transport settles the batch and before the
+// socket's "drain" event announces it.
+func TestWriteCallbackBeforeDrain(t *testing.T) {
+	url := newTestServer(t, nil)
+	s := openSocket(t, url, websocketOnly())
+
+	var mu sync.Mutex
+	var order []string
+	record := func(what string) {
+		mu.Lock()
+		order = append(order, what)
+		mu.Unlock()
+	}
+
+	drained := make(chan struct{}, 8)
+	s.On(EventDrain, func(...any) {
+		record("drain")
+		drained <- struct{}{}
+	})
+
+	for round := 0; round < 3; round++ {
+		s.WriteWithResult(_types.NewStringBufferString("ordered"), nil, func(err error) {
+			if err != nil {
+				t.Errorf("write callback got error %v on a healthy transport", err)
+			}
+			record("callback")
+		})
+		select {
+		case <-drained:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("round %d: no drain event", round)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 0; i+1 < len(order); i += 2 {
+		if order[i] != "callback" || order[i+1] != "drain" {
+			t.Fatalf("event order = %v, want each callback before its drain", order)
+		}
+	}
+}
+
+// TestFlushEventReportsBatch checks "flush" carries the batch summary and
+// the packet count handed to the transport.
+func TestFlushEventReportsBatch(t *testing.T) {
+	url := newTestServer(t, nil)
+	s := openSocket(t, url, websocketOnly())
+
+	flushes := make(chan []any, 8)
+	s.On(EventFlush, func(args ...any) {
+		select {
+		case flushes <- args:
+		default:
+		}
+	})
+
+	s.SendString("flushed")
+
+	select {
+	case args := <-flushes:
+		if len(args) != 2 {
+			t.Fatalf("flush event carried %d arguments, want batch and count", len(args))
+		}
+		batch, ok := args[0].([]FlushedPacket)
+		if !ok || len(batch) == 0 {
+			t.Fatalf("flush batch = %#v, want a non-empty []FlushedPacket", args[0])
+		}
+		if batch[0].Type != packet.MESSAGE {
+			t.Errorf("flushed packet type = %v, want MESSAGE", batch[0].Type)
+		}
+		if count, ok := args[1].(int); !ok || count != len(batch) {
+			t.Errorf("flush count = %v for a batch of %d", args[1], len(batch))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no flush event for a queued message")
+	}
+}
+
+// TestWaitForDrainFlushesBacklog queues a burst and checks WaitForDrain only
+// returns once the write buffer is empty - and respects its context when the
+// buffer cannot empty.
+func TestWaitForDrainFlushesBacklog(t *testing.T) {
+	url := newTestServer(t, nil)
+	s := openSocket(t, url, websocketOnly())
+
+	for i := 0; i < 10; i++ {
+		s.SendString("backlog")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.WaitForDrain(ctx); err != nil {
+		t.Fatalf("WaitForDrain: %v", err)
+	}
+	if got := s.WriteBufferLen(); got != 0 {
+		t.Errorf("write buffer holds %d packets after WaitForDrain", got)
+	}
+
+	// Against a peer that never answers the handshake, the context is the
+	// way out.
+	hung := NewSocket(hangingServer(t), pollingOnly())
+	t.Cleanup(func() { hung.Close() })
+	hung.SendString("never flushed")
+
+	short, cancelShort := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelShort()
+	if err := hung.WaitForDrain(short); err == nil {
+		t.Error("WaitForDrain returned nil while the buffer could not drain")
+	}
+}
@@ -0,0 +1,289 @@
+// Package engine implements the client half of the Engine.IO protocol,
+// mirroring the reference JavaScript `engine.io-client`. A socket starts on
+// HTTP long-polling and upgrades to WebSocket or WebTransport when the server
+// allows it.
+//
+// # Concurrency
+//
+// Once constructed, a socket may be shared across goroutines. The following
+// are safe to call from any goroutine:
+//
+//   - the write surface: Send, SendReader, SendStream, TrySend, Write and
+//     WriteWithResult/SendWithResult, including their callbacks
+//   - lifecycle: Open, Close, RefreshTransport, AbortUpgrade
+//   - getters: Id, ReadyState, Transport, WriteBufferLen, Upgrading,
+//     ConnectionPath, Handshake
+//   - instrumentation: Stats, Metrics, PacketCounts, ConnectTimings,
+//     LastRTT, AvgRTT
+//   - event registration through the embedded emitter (On, Once,
+//     RemoveListener, ...) and OnClosed, OnStateChange
+//
+// Construct snapshots its SocketOptions, so mutating the options value
+// afterwards does not affect the socket; the snapshot still shares any maps
+// and header values you passed in (Query, ExtraHeaders, ...), which must not
+// be mutated once the socket is opened.
+//
+// Not safe for concurrent use:
+//
+//   - the slice returned by WriteBuffer, which aliases the live write
+//     buffer; prefer WriteBufferLen
+//   - mutating the url.Values returned by Transport.Query; call SetQuery
+//     with a fresh map instead
+package engine
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/zishang520/engine.io-go-parser/packet"
+	_types "github.com/zishang520/engine.io-go-parser/types"
+	"github.com/zishang520/engine.io/v2/events"
+	"github.com/zishang520/engine.io/v2/types"
+)
+
+// Protocol is the Engine.IO protocol revision implemented by this client.
+const Protocol = 4
+
+// Version is the library version, advertised in the default User-Agent
+// header.
+const Version = "1.0.0"
+
+type (
+	// SocketState is the lifecycle state of a socket.
+	SocketState string
+
+	// TransportState is the lifecycle state of a transport.
+	TransportState string
+)
+
+const (
+	SocketStateOpening SocketState = "opening"
+	SocketStateOpen    SocketState = "open"
+	SocketStateClosing SocketState = "closing"
+	SocketStateClosed  SocketState = "closed"
+)
+
+// CacheBusterStrategy selects how the cache-busting timestamp query value is
+// generated; see SocketOptions.SetCacheBusterStrategy.
+type CacheBusterStrategy string
+
+const (
+	CacheBusterRandom    CacheBusterStrategy = "random"
+	CacheBusterMonotonic CacheBusterStrategy = "monotonic"
+)
+
+const (
+	TransportStateOpening TransportState = "opening"
+	TransportStateOpen    TransportState = "open"
+	TransportStateClosed  TransportState = "closed"
+	TransportStatePausing TransportState = "pausing"
+	TransportStatePaused  TransportState = "paused"
+)
+
+// Transport is the contract shared by the polling, websocket and webtransport
+// implementations. The unexported base struct supplies the common state
+// machine; concrete transports override DoOpen, DoClose and Write through the
+// Prototype mechanism.
+type Transport interface {
+	events.EventEmitter
+
+	// Prototype stores the outermost implementation so the base struct can
+	// dispatch overridable methods (DoOpen, DoClose, Write, ...) virtually.
+	Prototype(Transport)
+	Proto() Transport
+
+	Construct(SocketWithoutUpgrade, SocketOptionsInterface)
+
+	Name() string
+	Opts() SocketOptionsInterface
+	Socket() SocketWithoutUpgrade
+	Query() url.Values
+	SetQuery(url.Values)
+	ReadyState() TransportState
+	SetReadyState(TransportState)
+	Writable() bool
+	SetWritable(bool)
+	SupportsBinary() bool
+	OnAny(AnyListener)
+	OffAny(AnyListener) bool
+	Stats() TransportStats
+	CountWireBytes(uint64, uint64)
+	Metrics() TransportMetrics
+	CountSent(uint64, uint64)
+	CountReceived(uint64, uint64)
+	Undelivered() []*packet.Packet
+	SetUndelivered([]*packet.Packet)
+
+	Open() Transport
+	Close() Transport
+	Send([]*packet.Packet)
+	TrySend([]*packet.Packet) error
+	Pause(func())
+
+	CreateUri(string, url.Values) *url.URL
+
+	OnOpen()
+	OnData(_types.BufferInterface)
+	OnPacket(*packet.Packet)
+	OnError(string, error, any) Transport
+	OnClose(error)
+
+	DoOpen()
+	DoClose()
+	Write([]*packet.Packet)
+}
+
+type (
+	// Polling is the HTTP long-polling transport. ClearCookies drops the
+	// session cookies its HTTP client has collected for the connection's
+	// host - after a logout, say - so the next requests start fresh.
+	Polling interface {
+		Transport
+
+		ClearCookies()
+	}
+
+	// WebSocket is the WebSocket transport. Subprotocol exposes what the
+	// server selected from the offered Sec-WebSocket-Protocol list, with any
+	// token entry (see SetTokenViaSubprotocol) stripped. CompressionStats
+	// reports the payload bytes that went out compressed, before and after
+	// permessage-deflate, so the achieved ratio can be judged against the
+	// CPU spent; both are zero while compression never kicked in.
+	WebSocket interface {
+		Transport
+
+		Subprotocol() string
+		CompressionStats() (rawBytes, compressedBytes uint64)
+	}
+
+	// WebTransport is the WebTransport transport. On top of the reliable
+	// stream it exposes the session's unreliable datagram channel: raw
+	// datagrams go out via SendDatagram and received ones are emitted as
+	// "datagram" events carrying the []byte payload.
+	WebTransport interface {
+		Transport
+
+		SendDatagram([]byte) error
+	}
+)
+
+// DatagramSender is implemented by transports that expose an unreliable
+// datagram channel alongside the reliable Engine.IO stream (currently only
+// WebTransport). Whether the channel is actually usable is only known once
+// the session has been established; SupportsDatagrams reports the negotiated
+// capability.
+type DatagramSender interface {
+	SupportsDatagrams() bool
+	SendPacketDatagram(*packet.Packet) error
+}
+
+// BinaryStreamer is implemented by transports that can write a large binary
+// payload in chunks directly from a reader, without materializing it in
+// memory (currently only WebSocket, where protocol v4 frames binary MESSAGE
+// payloads without a header). size is the total payload length, known
+// upfront.
+type BinaryStreamer interface {
+	SendStream(data io.Reader, size int64) error
+}
+
+// SocketWithoutUpgrade provides a connection to the server on a single
+// transport, never upgrading it. It is the lean choice when the transport to
+// use is known upfront.
+type SocketWithoutUpgrade interface {
+	events.EventEmitter
+
+	Prototype(SocketWithoutUpgrade)
+	Proto() SocketWithoutUpgrade
+
+	Construct(string, SocketOptionsInterface)
+
+	// Context returns the context bound via the *Context constructors,
+	// context.Background() otherwise.
+	Context() context.Context
+	SetContext(context.Context)
+
+	Id() string
+	Generation() uint64
+	ConnectionPath() []string
+	Handshake() *HandshakeData
+	PingInterval() time.Duration
+	PingTimeout() time.Duration
+	LastRTT() time.Duration
+	AvgRTT() time.Duration
+	Transport() Transport
+	TransportName() string
+	ReadyState() SocketState
+	WriteBuffer() []*packet.Packet
+	WriteBufferLen() int
+	BufferedAmount() int64
+	PendingPackets() int
+	WaitForDrain(context.Context) error
+
+	// OnAny and OffAny manage wildcard listeners invoked for every event the
+	// socket emits, internal ones included; see AnyListener.
+	OnAny(AnyListener)
+	OffAny(AnyListener) bool
+	Opts() SocketOptionsInterface
+	Transports() *types.Set[string]
+	Upgrading() bool
+	SetUpgrading(bool)
+	PriorWebsocketSuccess() bool
+	SetPriorWebsocketSuccess(bool)
+	Stats() []TransportStats
+	PacketCounts() map[packet.Type]uint64
+	ConnectTimings() ConnectTimings
+
+	Open() SocketWithoutUpgrade
+	Send(io.Reader, *packet.Options, func()) SocketWithoutUpgrade
+	SendWithResult(io.Reader, *packet.Options, func(error)) SocketWithoutUpgrade
+	SendVolatile(io.Reader, *packet.Options, func()) SocketWithoutUpgrade
+	DroppedPackets() uint64
+	WriteWithResult(io.Reader, *packet.Options, func(error)) SocketWithoutUpgrade
+	TrySend(io.Reader, *packet.Options, func()) error
+	TryWrite(io.Reader, *packet.Options, func()) error
+	SendString(string, ...any) SocketWithoutUpgrade
+	SendBytes([]byte, ...any) SocketWithoutUpgrade
+	SendReader(io.Reader, ...any) SocketWithoutUpgrade
+	SendStream(io.Reader, int64, func()) error
+	Write(io.Reader, *packet.Options, func()) SocketWithoutUpgrade
+	SendDatagramPreferred(io.Reader, *packet.Options, func()) SocketWithoutUpgrade
+	Close() SocketWithoutUpgrade
+	CloseContext(context.Context) error
+
+	CreateTransport(string) (Transport, error)
+	SetTransport(Transport)
+	RefreshTransport()
+	TransportProblematic(string) bool
+	ClearCookies()
+	Flush()
+	QueueControlPacket(*packet.Packet)
+	HasPingExpired() bool
+	OnStateChange(func(old SocketState, new SocketState))
+	OnClosed(func(reason error))
+
+	OnOpen()
+	OnHandshake(*HandshakeData)
+	OnPacket(*packet.Packet)
+	OnError(error)
+	OnClose(string, error)
+}
+
+// SocketWithUpgrade adds the transport upgrade mechanism on top of
+// SocketWithoutUpgrade: once the initial transport is open the server-offered
+// upgrades are probed and the best working transport takes over.
+type SocketWithUpgrade interface {
+	SocketWithoutUpgrade
+
+	Upgrades() []string
+	AvailableUpgrades() []string
+	ClearUpgrades()
+	AbortUpgrade() bool
+	ProbeUpgrade(string) error
+}
+
+// Socket is the general-purpose client: long-polling first, then upgrade.
+type Socket interface {
+	SocketWithUpgrade
+}
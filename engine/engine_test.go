@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zishang520/engine.io/v2/config"
+	eio "github.com/zishang520/engine.io/v2/engine"
+	"github.com/zishang520/engine.io/v2/events"
+	"github.com/zishang520/engine.io/v2/types"
+)
+
+// testServerOptions returns server options tuned for tests: heartbeats quick
+// enough to observe, timeouts short enough not to drag a failing test out.
+func testServerOptions() *config.ServerOptions {
+	opts := config.DefaultServerOptions()
+	opts.SetPingInterval(500 * time.Millisecond)
+	opts.SetPingTimeout(2 * time.Second)
+	return opts
+}
+
+// newTestServer starts a reference Engine.IO server that echoes every
+// message back to its sender, returning the base http:// URL to connect to.
+// A nil opts gets testServerOptions.
+func newTestServer(t *testing.T, opts *config.ServerOptions) string {
+	t.Helper()
+
+	if opts == nil {
+		opts = testServerOptions()
+	}
+
+	server := eio.NewServer(opts)
+	server.On("connection", func(args ...any) {
+		socket, ok := args[0].(eio.Socket)
+		if !ok {
+			return
+		}
+		socket.On("data", func(data ...any) {
+			if len(data) == 0 {
+				return
+			}
+			if payload, ok := data[0].(io.Reader); ok {
+				socket.Send(payload, nil, nil)
+			}
+		})
+	})
+
+	ts := httptest.NewServer(server)
+	t.Cleanup(func() {
+		server.Close()
+		ts.Close()
+	})
+
+	return ts.URL
+}
+
+// pollingOnly returns options restricted to the polling transport.
+func pollingOnly() *SocketOptions {
+	opts := DefaultSocketOptions()
+	opts.SetTransports(types.NewSet("polling"))
+	return opts
+}
+
+// websocketOnly returns options restricted to the websocket transport.
+func websocketOnly() *SocketOptions {
+	opts := DefaultSocketOptions()
+	opts.SetTransports(types.NewSet("websocket"))
+	return opts
+}
+
+// waitForEvent blocks until the socket emits evt, returning the event
+// arguments, and fails the test after timeout.
+func waitForEvent(t *testing.T, s SocketWithoutUpgrade, evt events.EventName, timeout time.Duration) []any {
+	t.Helper()
+
+	received := make(chan []any, 1)
+	listener := func(args ...any) {
+		select {
+		case received <- args:
+		default:
+		}
+	}
+	s.Once(evt, listener)
+	defer s.RemoveListener(evt, listener)
+
+	select {
+	case args := <-received:
+		return args
+	case <-time.After(timeout):
+		t.Fatalf("timed out after %v waiting for %q", timeout, evt)
+		return nil
+	}
+}
+
+// openSocket connects to url and waits for the open event.
+func openSocket(t *testing.T, url string, opts SocketOptionsInterface) Socket {
+	t.Helper()
+
+	s := NewSocket(url, opts)
+	t.Cleanup(func() { s.Close() })
+	waitForEvent(t, s, EventOpen, 5*time.Second)
+	return s
+}
+
+// waitForClosed blocks until the socket reports its terminal close.
+func waitForClosed(t *testing.T, s SocketWithoutUpgrade, timeout time.Duration) {
+	t.Helper()
+
+	closed := make(chan struct{})
+	s.OnClosed(func(error) { close(closed) })
+	select {
+	case <-closed:
+	case <-time.After(timeout):
+		t.Fatalf("timed out after %v waiting for the socket to close", timeout)
+	}
+}
@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zishang520/engine.io-go-parser/packet"
+)
+
+// ErrTransportNotOpen is returned by Transport.TrySend when the transport is
+// not open and the packets were not written.
+var ErrTransportNotOpen = errors.New("transport is not open")
+
+// ErrSocketClosed is returned by the socket's TrySend/TryWrite when the
+// socket is closing or closed and the message was not queued.
+var ErrSocketClosed = errors.New("socket is closing or closed")
+
+// ErrStreamingNotSupported is returned by SendStream when the active
+// transport cannot write a payload in chunks; upgrade to websocket first.
+var ErrStreamingNotSupported = errors.New("transport does not support streaming sends - upgrade to websocket first")
+
+// ErrBufferFull is returned by sends when a write buffer cap
+// (MaxBufferedPackets/MaxBufferedBytes) is hit and BlockOnBufferFull is
+// disabled; the packet was not queued.
+var ErrBufferFull = errors.New("write buffer is full")
+
+// Error is the error value delivered with "error" events on sockets and
+// transports. Message is a short stable identifier ("xhr poll error",
+// "websocket error", ...), Description the underlying cause when known and
+// Context optional extra data for diagnostics.
+type Error struct {
+	Message     string
+	Description error
+	Context     any
+}
+
+func NewError(message string, description error, context any) *Error {
+	return &Error{
+		Message:     message,
+		Description: description,
+		Context:     context,
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Description != nil {
+		return e.Message + ": " + e.Description.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Description
+}
+
+// TimeoutError reports an operation that did not finish within its configured
+// deadline - connection establishment bounded by OpenTimeout, upgrade probes
+// bounded by ProbeTimeout.
+type TimeoutError struct {
+	// Op names the timed-out operation ("open", "probe").
+	Op string
+
+	// After is the deadline that was exceeded.
+	After time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return e.Op + " timed out after " + e.After.String()
+}
+
+// Timeout reports true, following the net.Error convention.
+func (e *TimeoutError) Timeout() bool { return true }
+
+// HandshakeError describes a failed connection handshake, carrying the
+// server's response details when a response was received at all.
+type HandshakeError struct {
+	// Cause is the underlying failure.
+	Cause error
+
+	// StatusCode and Body are the server's response status and payload,
+	// zero and nil when the request never got a response.
+	StatusCode int
+	Body       []byte
+}
+
+func (e *HandshakeError) Error() string {
+	msg := "handshake failed"
+	if e.Cause != nil {
+		msg += ": " + e.Cause.Error()
+	}
+	if e.StatusCode != 0 {
+		msg += " (status " + strconv.Itoa(e.StatusCode) + ")"
+	}
+	return msg
+}
+
+func (e *HandshakeError) Unwrap() error {
+	return e.Cause
+}
+
+// PayloadTooLargeError reports a packet rejected client-side because its
+// encoded size exceeds the effective max payload (the MaxPayload option, or
+// the handshake value when unset). Polling splits its batches instead; this
+// only arises on transports with per-packet framing, where an oversized
+// packet would make the server kill the connection.
+type PayloadTooLargeError struct {
+	// Size is the packet's encoded size, Limit the max payload in force.
+	Size  int64
+	Limit int64
+}
+
+func (e *PayloadTooLargeError) Error() string {
+	return "packet of " + strconv.FormatInt(e.Size, 10) + " bytes exceeds max payload " + strconv.FormatInt(e.Limit, 10)
+}
+
+// CloseInfo is the close description delivered when the peer sent a proper
+// websocket close frame: the close code and reason from the frame, with the
+// underlying read error in Err. It lets listeners tell a normal 1000 close
+// from, say, a 1011 server error when deciding whether to reconnect.
+type CloseInfo struct {
+	// Code is the websocket close code (RFC 6455 section 7.4).
+	Code int
+
+	// Reason is the optional human-readable text of the close frame.
+	Reason string
+
+	// Err is the read error the close frame surfaced as.
+	Err error
+}
+
+func (c *CloseInfo) Error() string {
+	msg := "websocket closed with code " + strconv.Itoa(c.Code)
+	if c.Reason != "" {
+		msg += ": " + c.Reason
+	}
+	return msg
+}
+
+func (c *CloseInfo) Unwrap() error {
+	return c.Err
+}
+
+// CloseDetails is the close description delivered with "close" events when
+// the transport can tell which packets of its most recent write batch never
+// made it onto the wire. Applications may re-queue Undelivered on a fresh
+// socket instead of treating everything since the last ack as lost.
+type CloseDetails struct {
+	// Description is the underlying close cause.
+	Description error
+
+	// Undelivered holds the packets of the last write batch that were
+	// definitely not written, in their original order. Packets whose write
+	// failed mid-flight are ambiguous and not included.
+	Undelivered []*packet.Packet
+
+	// ConnectionPath lists the transports the session went through, in
+	// order; see SocketWithoutUpgrade.ConnectionPath.
+	ConnectionPath []string
+}
+
+func (c *CloseDetails) Error() string {
+	msg := "transport closed"
+	if c.Description != nil {
+		msg = c.Description.Error()
+	}
+	if n := len(c.Undelivered); n > 0 {
+		msg += " (" + strconv.Itoa(n) + " undelivered packets)"
+	}
+	if len(c.ConnectionPath) > 0 {
+		msg += " (via " + strings.Join(c.ConnectionPath, " -> ") + ")"
+	}
+	return msg
+}
+
+func (c *CloseDetails) Unwrap() error {
+	return c.Description
+}
@@ -0,0 +1,265 @@
+package engine
+
+import (
+	"reflect"
+	"sync"
+
+	_types "github.com/zishang520/engine.io-go-parser/types"
+	"github.com/zishang520/engine.io/v2/events"
+)
+
+// Event names emitted by the sockets and transports. Using the constants
+// instead of bare strings keeps typos from silently registering listeners on
+// events that never fire.
+const (
+	// EventOpen fires once the connection (or transport) is open. On sockets
+	// it carries the attempt's ConnectTimings.
+	EventOpen events.EventName = "open"
+
+	// EventClose fires when the connection (or transport) is closed. On
+	// sockets the listener receives the close reason and an optional
+	// description; on transports a single error, possibly a *CloseDetails.
+	EventClose events.EventName = "close"
+
+	// EventError fires on connection or transport failures.
+	EventError events.EventName = "error"
+
+	// EventMessage fires with every MESSAGE payload received from the
+	// server. EventData is its legacy alias; both fire for each payload.
+	EventMessage events.EventName = "message"
+	EventData    events.EventName = "data"
+
+	// EventPacket fires with every decoded packet.
+	EventPacket events.EventName = "packet"
+
+	// EventPacketCreate fires with every outgoing *packet.Packet, once per
+	// send, just before it is queued for flushing - the send-side mirror of
+	// EventPacket. Listeners may tweak Options (setting Compress, say)
+	// before the packet is encoded; mutating Data is at the caller's risk.
+	EventPacketCreate events.EventName = "packetCreate"
+
+	// EventHandshake fires once per connection with the *HandshakeData the
+	// server sent, before EventOpen; see also Handshake().
+	EventHandshake events.EventName = "handshake"
+
+	// EventRawHandshake fires just before EventHandshake with the raw []byte
+	// payload of the server's OPEN packet, exactly as it arrived. For
+	// debugging servers whose handshake deviates from spec in ways the
+	// parsed *HandshakeData hides.
+	EventRawHandshake events.EventName = "rawHandshake"
+
+	// EventHeartbeat fires whenever a packet proves the server is alive.
+	// When a heartbeat cycle produced a round-trip estimate (see LastRTT) it
+	// fires once more with the time.Duration as its argument.
+	EventHeartbeat events.EventName = "heartbeat"
+
+	// EventPing fires when the server's heartbeat PING arrives, EventPong
+	// once the PONG answer was confirmed written - one pair per heartbeat
+	// cycle, mirroring the JS client. The optional heartbeat payload rides
+	// along on both; EventPong additionally carries the PING-to-PONG delay
+	// as a time.Duration. Probe PING/PONGs of the upgrade machinery stay on
+	// the probing transport and never surface here.
+	EventPing events.EventName = "ping"
+	EventPong events.EventName = "pong"
+
+	// EventPingLate fires, with the lateness as a time.Duration, when a
+	// heartbeat deadline check lands inside the PingTimeoutGrace window: the
+	// heartbeat is overdue but the connection is not yet declared dead.
+	EventPingLate events.EventName = "ping_late"
+
+	// EventFlush fires when buffered packets are handed to the transport,
+	// carrying a []FlushedPacket describing the batch and the packet count;
+	// EventDrain fires when the transport has written them out.
+	EventFlush events.EventName = "flush"
+	EventDrain events.EventName = "drain"
+
+	// EventWritable fires on a transport whenever it transitions from
+	// not-writable to writable - on open and after each drain - so senders
+	// can react to the exact moment without polling Writable(). Distinct
+	// from EventDrain, which reports a completed write.
+	EventWritable events.EventName = "writable"
+
+	// EventUpgrading, EventUpgrade and EventUpgradeError track the transport
+	// upgrade probes. EventUpgrade carries the promoted Transport and an
+	// *UpgradeInfo with the probe timing.
+	EventUpgrading    events.EventName = "upgrading"
+	EventUpgrade      events.EventName = "upgrade"
+	EventUpgradeError events.EventName = "upgradeError"
+
+	// EventUpgradeAborted fires when AbortUpgrade cancels probes that were
+	// still in flight.
+	EventUpgradeAborted events.EventName = "upgradeAborted"
+
+	// EventUpgradesFiltered fires once per handshake with the filtering
+	// outcome of the server-advertised upgrades: the server's list, the
+	// client's configured transports and their intersection, each a
+	// []string. Diagnostic aid for "no upgrade happened" mysteries.
+	EventUpgradesFiltered events.EventName = "upgradesFiltered"
+
+	// EventTransportDegraded fires when the active transport's error rate
+	// crosses TransportErrorThreshold; see SocketOptions.
+	EventTransportDegraded events.EventName = "transportDegraded"
+
+	// EventTransportDowngrade fires with a transport name and its ping
+	// timeout count when repeated ping timeouts mark that transport as
+	// problematic (see SocketOptions.DowngradeAfterPingTimeouts); subsequent
+	// reconnects prefer polling over it.
+	EventTransportDowngrade events.EventName = "transportDowngrade"
+
+	// EventTransportRefresh fires with the freshly swapped-in Transport when
+	// a RefreshTransport call completes: same session, new connection.
+	EventTransportRefresh events.EventName = "transportRefresh"
+
+	// EventTransportChange fires with the new Transport whenever the active
+	// transport is swapped - the initial one, an upgrade, a refresh - before
+	// its listeners are bound. See also TransportName.
+	EventTransportChange events.EventName = "transportChange"
+
+	// EventTransportMismatch fires, with a descriptive error, when received
+	// data does not match the active transport's wire framing - typically a
+	// proxy rewriting the connection (say, websocket frames surfacing on a
+	// polling response). Purely diagnostic: decoding still runs its course.
+	EventTransportMismatch events.EventName = "transportMismatch"
+
+	// EventDatagram fires on the webtransport transport with the raw []byte
+	// of every datagram received on the session's unreliable channel.
+	EventDatagram events.EventName = "datagram"
+
+	// EventDatagramUnavailable fires on the first datagram-preferred send
+	// that has to fall back to the reliable path; see SendDatagramPreferred.
+	EventDatagramUnavailable events.EventName = "datagramUnavailable"
+
+	// EventNoop fires for every server-sent NOOP packet, on the transport
+	// that received it and on the socket.
+	EventNoop events.EventName = "noop"
+
+	// EventEvicted fires on a socket just before a SocketPool closes it to
+	// get back under its connection budget.
+	EventEvicted events.EventName = "evicted"
+
+	// EventReconnectScheduled fires before each reconnect wait (see
+	// SocketOptions.Reconnection) with the attempt number (int, starting at
+	// 1) and the computed backoff delay (time.Duration), so the
+	// backoff/jitter configuration can be observed instead of
+	// reverse-engineered from timing.
+	EventReconnectScheduled events.EventName = "reconnectScheduled"
+
+	// EventReconnectFailed fires, with the number of failed attempts, when
+	// MaxReconnectionAttempts is exhausted and the socket gives up
+	// reconnecting; the "close" event follows as for any final close.
+	EventReconnectFailed events.EventName = "reconnect_failed"
+
+	// EventPoll and EventPollComplete frame each long-polling request on the
+	// polling transport.
+	EventPoll         events.EventName = "poll"
+	EventPollComplete events.EventName = "pollComplete"
+)
+
+// OnMessage registers fn for the socket's EventMessage, taking care of the
+// ...any unpacking. String and binary payloads both arrive as a buffer;
+// binary ones are everything that is not a *types.StringBuffer.
+func OnMessage(s SocketWithoutUpgrade, fn func(_types.BufferInterface)) error {
+	return s.On(EventMessage, func(args ...any) {
+		if len(args) > 0 {
+			if data, ok := args[0].(_types.BufferInterface); ok {
+				fn(data)
+			}
+		}
+	})
+}
+
+// OnError registers fn for the socket's EventError. Plain errors emitted by
+// the socket itself are wrapped into an *Error for a uniform signature.
+func OnError(s SocketWithoutUpgrade, fn func(*Error)) error {
+	return s.On(EventError, func(args ...any) {
+		if len(args) == 0 {
+			return
+		}
+		switch err := args[0].(type) {
+		case *Error:
+			fn(err)
+		case error:
+			fn(NewError("error", err, nil))
+		}
+	})
+}
+
+// OnClose registers fn for the socket's EventClose, unpacking the close
+// reason and the optional description (which may be a *CloseDetails carrying
+// undelivered packets).
+func OnClose(s SocketWithoutUpgrade, fn func(reason string, description error)) error {
+	return s.On(EventClose, func(args ...any) {
+		var reason string
+		var description error
+		if len(args) > 0 {
+			reason, _ = args[0].(string)
+		}
+		if len(args) > 1 {
+			description, _ = args[1].(error)
+		}
+		fn(reason, description)
+	})
+}
+
+// OnOpen registers fn for the socket's EventOpen.
+func OnOpen(s SocketWithoutUpgrade, fn func()) error {
+	return s.On(EventOpen, func(...any) {
+		fn()
+	})
+}
+
+// AnyListener receives every event emitted on a socket or transport: the
+// event name plus whatever arguments the emit carried. See OnAny.
+type AnyListener func(event string, args ...any)
+
+// anyListeners is the wildcard listener list behind OnAny/OffAny, shared by
+// the socket and transport bases. dispatch snapshots the list and invokes the
+// listeners outside the lock, so a wildcard listener is free to emit, register
+// or remove without deadlocking; per-event Once semantics are untouched since
+// the regular emitter never sees these listeners.
+type anyListeners struct {
+	mu  sync.Mutex
+	fns []AnyListener
+}
+
+func (a *anyListeners) add(fn AnyListener) {
+	if fn == nil {
+		return
+	}
+	a.mu.Lock()
+	a.fns = append(a.fns, fn)
+	a.mu.Unlock()
+}
+
+// remove drops fn from the list, comparing by function pointer like the
+// emitter's RemoveListener; a nil fn clears every wildcard listener. Reports
+// whether anything was removed.
+func (a *anyListeners) remove(fn AnyListener) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if fn == nil {
+		removed := len(a.fns) > 0
+		a.fns = nil
+		return removed
+	}
+
+	ptr := reflect.ValueOf(fn).Pointer()
+	for i, registered := range a.fns {
+		if reflect.ValueOf(registered).Pointer() == ptr {
+			a.fns = append(a.fns[:i], a.fns[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (a *anyListeners) dispatch(evt events.EventName, args ...any) {
+	a.mu.Lock()
+	fns := append([]AnyListener(nil), a.fns...)
+	a.mu.Unlock()
+
+	for _, fn := range fns {
+		fn(string(evt), args...)
+	}
+}
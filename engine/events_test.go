@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_types "github.com/zishang520/engine.io-go-parser/types"
+	eio "github.com/zishang520/engine.io/v2/engine"
+)
+
+// TestTypedListenerHelpers feeds the typed registration helpers both payload
+// flavors and the error shapes the socket emits, checking the ...any
+// unpacking they exist to hide.
+func TestTypedListenerHelpers(t *testing.T) {
+	s := MakeSocketWithoutUpgrade()
+
+	t.Run("message", func(t *testing.T) {
+		var payloads []_types.BufferInterface
+		OnMessage(s, func(data _types.BufferInterface) {
+			payloads = append(payloads, data)
+		})
+
+		s.Emit(EventMessage, _types.NewStringBufferString("text payload"))
+		s.Emit(EventMessage, _types.NewBytesBuffer([]byte{0x01, 0x02, 0x03}))
+		s.Emit(EventMessage) // malformed emit: no payload, must not panic
+
+		if len(payloads) != 2 {
+			t.Fatalf("expected 2 payloads, got %d", len(payloads))
+		}
+		if _, ok := payloads[0].(*_types.StringBuffer); !ok {
+			t.Errorf("first payload should be a string buffer, got %T", payloads[0])
+		}
+		if _, ok := payloads[1].(*_types.StringBuffer); ok {
+			t.Errorf("second payload should be binary, got a string buffer")
+		}
+		if got := payloads[1].Bytes(); len(got) != 3 || got[0] != 0x01 {
+			t.Errorf("binary payload mangled: %v", got)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		var seen []*Error
+		OnError(s, func(err *Error) {
+			seen = append(seen, err)
+		})
+
+		typed := NewError("probe error", errors.New("boom"), nil)
+		s.Emit(EventError, typed)
+		s.Emit(EventError, errors.New("plain"))
+
+		if len(seen) != 2 {
+			t.Fatalf("expected 2 errors, got %d", len(seen))
+		}
+		if seen[0] != typed {
+			t.Errorf("typed error should pass through untouched")
+		}
+		if seen[1] == nil || seen[1].Description == nil || seen[1].Description.Error() != "plain" {
+			t.Errorf("plain error should be wrapped into *Error, got %+v", seen[1])
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		var gotReason string
+		var gotDescription error
+		OnClose(s, func(reason string, description error) {
+			gotReason = reason
+			gotDescription = description
+		})
+
+		details := &CloseDetails{Description: errors.New("died")}
+		s.Emit(EventClose, "transport error", details)
+
+		if gotReason != "transport error" {
+			t.Errorf("reason = %q, want %q", gotReason, "transport error")
+		}
+		if gotDescription != error(details) {
+			t.Errorf("description = %v, want the emitted *CloseDetails", gotDescription)
+		}
+	})
+}
+
+// TestCloseCarriesUndeliveredBatch kills the connection mid-batch: once the
+// session is up every POST is accepted and then severed, so the next write
+// batch fails at the HTTP level. The close description must identify that
+// batch as undelivered and the write callbacks must settle with an error.
+func TestCloseCarriesUndeliveredBatch(t *testing.T) {
+	server := eio.NewServer(testServerOptions())
+	defer server.Close()
+
+	var failPosts atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failPosts.Load() && r.Method == http.MethodPost {
+			if hijacker, ok := w.(http.Hijacker); ok {
+				if conn, _, err := hijacker.Hijack(); err == nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+		server.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	s := openSocket(t, ts.URL, pollingOnly())
+
+	closed := make(chan error, 1)
+	OnClose(s, func(reason string, description error) {
+		select {
+		case closed <- description:
+		default:
+		}
+	})
+
+	settled := make(chan error, 1)
+	failPosts.Store(true)
+	s.WriteWithResult(_types.NewStringBufferString("doomed"), nil, func(err error) {
+		select {
+		case settled <- err:
+		default:
+		}
+	})
+
+	var description error
+	select {
+	case description = <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("socket never closed after the severed POST")
+	}
+
+	var details *CloseDetails
+	if !errors.As(description, &details) {
+		t.Fatalf("close description %T does not carry *CloseDetails", description)
+	}
+	if len(details.Undelivered) == 0 {
+		t.Fatalf("expected the failed batch in Undelivered, got none (description: %v)", details)
+	}
+
+	select {
+	case err := <-settled:
+		if err == nil {
+			t.Error("write callback settled without an error for an undelivered packet")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("write callback never settled")
+	}
+}
@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	_types "github.com/zishang520/engine.io-go-parser/types"
+)
+
+// TestConnectionChurnUnderTraffic churns connections while traffic flows:
+// each round opens a socket, blasts sends from a background goroutine, swaps
+// the transport mid-stream and closes. Stale events from the torn-down
+// transports must not corrupt the replacement (generation stamping); the run
+// doubles as a data-race probe for the teardown paths. Sockets stay on
+// websocket throughout: the reference server's upgrade path has a known data
+// race of its own that would drown out client findings under -race.
+func TestConnectionChurnUnderTraffic(t *testing.T) {
+	url := newTestServer(t, nil)
+
+	for round := 0; round < 8; round++ {
+		s := openSocket(t, url, websocketOnly())
+
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(time.Millisecond)
+			defer ticker.Stop()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+					s.Send(_types.NewStringBufferString("churn-"+strconv.Itoa(i)), nil, nil)
+				}
+			}
+		}()
+
+		s.RefreshTransport()
+
+		// The refreshed transport must still carry traffic on the same
+		// session.
+		echoRound(t, s, 1)
+
+		close(stop)
+		wg.Wait()
+		s.Close()
+		waitForClosed(t, s, 5*time.Second)
+	}
+
+	// The churn must not have wedged anything server- or client-side.
+	s := openSocket(t, url, websocketOnly())
+	echoRound(t, s, 2)
+}
+
+// TestHeartbeatEventsOncePerCycle counts ping/pong emissions against a
+// server heartbeating every 100ms: one pair per cycle, and nothing leaked
+// from the upgrade probe's PING/PONG exchange.
+func TestHeartbeatEventsOncePerCycle(t *testing.T) {
+	opts := testServerOptions()
+	opts.SetPingInterval(100 * time.Millisecond)
+	opts.SetPingTimeout(time.Second)
+	url := newTestServer(t, opts)
+
+	var mu sync.Mutex
+	var pings, pongs int
+	var payloads []string
+
+	s := NewSocket(url, DefaultSocketOptions())
+	t.Cleanup(func() { s.Close() })
+	s.On(EventPing, func(args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		pings++
+		if len(args) > 0 {
+			if data, ok := args[0].(_types.BufferInterface); ok && data != nil {
+				payloads = append(payloads, data.String())
+			}
+		}
+	})
+	s.On(EventPong, func(args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		pongs++
+		if len(args) > 0 {
+			if data, ok := args[0].(_types.BufferInterface); ok && data != nil {
+				payloads = append(payloads, data.String())
+			}
+		}
+	})
+
+	waitForEvent(t, s, EventOpen, 5*time.Second)
+	waitForEvent(t, s, EventUpgrade, 5*time.Second) // probe runs inside the window
+	time.Sleep(time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// ~10 cycles elapsed; wide bounds keep scheduler noise out of the
+	// verdict while still catching doubled or missing emissions.
+	if pings < 5 || pings > 15 {
+		t.Errorf("pings = %d over ~10 heartbeat cycles", pings)
+	}
+	if diff := pings - pongs; diff < -1 || diff > 1 {
+		t.Errorf("pings (%d) and pongs (%d) out of step", pings, pongs)
+	}
+	for _, payload := range payloads {
+		if payload == "probe" {
+			t.Errorf("upgrade probe PING/PONG leaked into the heartbeat events")
+			break
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_types "github.com/zishang520/engine.io-go-parser/types"
+)
+
+// TestMaxPayloadBoundaryWebsocket drives the client against a server that
+// advertises a small maxPayload and checks the boundary exactly: a string
+// packet whose framed size equals the limit goes through, one byte more is
+// rejected client-side with a typed error on both the callback and the
+// error event.
+func TestMaxPayloadBoundaryWebsocket(t *testing.T) {
+	const limit = 1024
+
+	serverOpts := testServerOptions()
+	serverOpts.SetMaxHttpBufferSize(limit)
+	url := newTestServer(t, serverOpts)
+
+	s := openSocket(t, url, websocketOnly())
+	messages := collectMessages(s)
+
+	errorEvents := make(chan *Error, 1)
+	s.On(EventError, func(args ...any) {
+		if len(args) > 0 {
+			if err, ok := args[0].(*Error); ok && err.Message == "payload too large" {
+				select {
+				case errorEvents <- err:
+				default:
+				}
+			}
+		}
+	})
+
+	// A string packet frames as the type byte plus the data: limit-1 bytes
+	// of payload sit exactly at the boundary and must survive.
+	atLimit := strings.Repeat("a", limit-1)
+	s.SendString(atLimit)
+	select {
+	case msg := <-messages:
+		if buf, ok := msg.(_types.BufferInterface); !ok || buf.String() != atLimit {
+			t.Error("packet at the boundary came back mangled")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("packet exactly at maxPayload was not delivered")
+	}
+
+	// One byte more and the frame exceeds the handshake limit.
+	cbErrs := make(chan error, 1)
+	s.WriteWithResult(_types.NewStringBufferString(atLimit+"b"), nil, func(err error) {
+		cbErrs <- err
+	})
+
+	var tooLarge *PayloadTooLargeError
+	select {
+	case err := <-cbErrs:
+		if !errors.As(err, &tooLarge) {
+			t.Errorf("callback error = %v, want a *PayloadTooLargeError", err)
+		} else if tooLarge.Size != limit+1 || tooLarge.Limit != limit {
+			t.Errorf("rejected with size %d limit %d, want %d over %d", tooLarge.Size, tooLarge.Limit, limit+1, limit)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("oversized packet's callback never fired")
+	}
+	select {
+	case <-errorEvents:
+	case <-time.After(5 * time.Second):
+		t.Fatal(`no "payload too large" error event for the oversized packet`)
+	}
+
+	s.Close()
+	waitForClosed(t, s, 5*time.Second)
+}
+
+// TestMaxPayloadSplitsPollingBatches checks the polling write path cuts its
+// batches so no single POST body exceeds the advertised maxPayload, while
+// every queued packet still arrives.
+func TestMaxPayloadSplitsPollingBatches(t *testing.T) {
+	const limit = 1024
+
+	serverOpts := testServerOptions()
+	serverOpts.SetMaxHttpBufferSize(limit)
+	base := newTestServer(t, serverOpts)
+
+	// Proxy every request through a body-measuring handler; the client must
+	// never produce a POST payload over the limit.
+	var oversized atomic.Int64
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := base + r.URL.Path
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		var body []byte
+		if r.Body != nil {
+			body, _ = io.ReadAll(r.Body)
+		}
+		if r.Method == http.MethodPost && len(body) > limit {
+			oversized.Add(1)
+		}
+		req, err := http.NewRequestWithContext(r.Context(), r.Method, target, bytes.NewReader(body))
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		req.Header = r.Header.Clone()
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		for key, values := range res.Header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+	}))
+	t.Cleanup(proxy.Close)
+
+	s := openSocket(t, proxy.URL, pollingOnly())
+	messages := collectMessages(s)
+
+	// A burst bigger than one POST can carry: the first flush takes one
+	// packet, the rest queue behind the in-flight request and must be split
+	// across follow-up POSTs.
+	const count, payloadLen = 6, 400
+	payload := strings.Repeat("x", payloadLen)
+	for i := 0; i < count; i++ {
+		s.SendString(payload)
+	}
+
+	for i := 0; i < count; i++ {
+		select {
+		case <-messages:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("echo %d of %d never arrived", i+1, count)
+		}
+	}
+
+	if n := oversized.Load(); n > 0 {
+		t.Errorf("%d POST bodies exceeded the %d byte maxPayload", n, limit)
+	}
+
+	s.Close()
+	waitForClosed(t, s, 5*time.Second)
+}
@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	eio "github.com/zishang520/engine.io/v2/engine"
+)
+
+// memoryListener is a net.Listener fed by Dial: every Dial hands one end of a
+// net.Pipe to the caller and queues the other for Accept.
+type memoryListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+}
+
+func newMemoryListener() *memoryListener {
+	return &memoryListener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *memoryListener) Dial() (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (l *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, errors.New("listener closed")
+	}
+}
+
+func (l *memoryListener) Close() error {
+	select {
+	case <-l.done:
+	default:
+		close(l.done)
+	}
+	return nil
+}
+
+func (l *memoryListener) Addr() net.Addr {
+	return &net.UnixAddr{Name: "in-memory", Net: "unix"}
+}
+
+// TestWebsocketOverInMemoryPipe routes the whole WebSocket session - HTTP
+// upgrade included - through net.Pipe via SetNetDial: no real sockets, yet a
+// fully working connection.
+func TestWebsocketOverInMemoryPipe(t *testing.T) {
+	server := eio.NewServer(testServerOptions())
+	server.On("connection", func(args ...any) {
+		if socket, ok := args[0].(eio.Socket); ok {
+			socket.On("data", func(data ...any) {
+				if len(data) > 0 {
+					if payload, ok := data[0].(io.Reader); ok {
+						socket.Send(payload, nil, nil)
+					}
+				}
+			})
+		}
+	})
+	defer server.Close()
+
+	listener := newMemoryListener()
+	defer listener.Close()
+
+	httpServer := &http.Server{Handler: server}
+	go httpServer.Serve(listener)
+	defer httpServer.Close()
+
+	opts := websocketOnly()
+	opts.SetNetDial(func(network string, addr string) (net.Conn, error) {
+		return listener.Dial()
+	})
+
+	// The host is never resolved - the dial hook short-circuits it.
+	s := openSocket(t, "http://in-memory.invalid", opts)
+
+	echoRound(t, s, 3)
+
+	if got := s.TransportName(); got != "websocket" {
+		t.Errorf("transport = %q, want websocket", got)
+	}
+	s.Close()
+	waitForClosed(t, s, 5*time.Second)
+}
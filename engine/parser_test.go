@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zishang520/engine.io-go-parser/packet"
+	"github.com/zishang520/engine.io-go-parser/parser"
+	_types "github.com/zishang520/engine.io-go-parser/types"
+)
+
+// countingParser wraps another parser and tallies every encode and decode
+// that flows through it - the instrumentation use case SetParser exists for.
+type countingParser struct {
+	inner    parser.Parser
+	encoded  atomic.Int64
+	decoded  atomic.Int64
+	payloads atomic.Int64
+}
+
+func (c *countingParser) Protocol() int { return c.inner.Protocol() }
+
+func (c *countingParser) EncodePacket(pkt *packet.Packet, supportsBinary bool, utf8encode ...bool) (_types.BufferInterface, error) {
+	c.encoded.Add(1)
+	return c.inner.EncodePacket(pkt, supportsBinary, utf8encode...)
+}
+
+func (c *countingParser) DecodePacket(data _types.BufferInterface, utf8decode ...bool) (*packet.Packet, error) {
+	c.decoded.Add(1)
+	return c.inner.DecodePacket(data, utf8decode...)
+}
+
+func (c *countingParser) EncodePayload(packets []*packet.Packet, supportsBinary ...bool) (_types.BufferInterface, error) {
+	c.payloads.Add(1)
+	c.encoded.Add(int64(len(packets)))
+	return c.inner.EncodePayload(packets, supportsBinary...)
+}
+
+func (c *countingParser) DecodePayload(data _types.BufferInterface) ([]*packet.Packet, error) {
+	packets, err := c.inner.DecodePayload(data)
+	c.payloads.Add(1)
+	c.decoded.Add(int64(len(packets)))
+	return packets, err
+}
+
+// TestInjectedParserCarriesHandshake runs a full polling handshake and an
+// echo round through a wrapping parser injected via SetParser, and checks
+// every packet on the wire went through it: the handshake OPEN decode, the
+// outgoing message encode and the echoed message decode.
+func TestInjectedParserCarriesHandshake(t *testing.T) {
+	url := newTestServer(t, nil)
+
+	counting := &countingParser{inner: parser.Parserv4()}
+	opts := pollingOnly()
+	opts.SetParser(counting)
+
+	s := openSocket(t, url, opts)
+
+	if counting.decoded.Load() == 0 {
+		t.Fatal("handshake completed without the injected parser decoding anything")
+	}
+
+	decodedBefore := counting.decoded.Load()
+	encodedBefore := counting.encoded.Load()
+
+	messages := collectMessages(s)
+	s.SendString("through the wrapper")
+	select {
+	case msg := <-messages:
+		if buf, ok := msg.(_types.BufferInterface); !ok || buf.String() != "through the wrapper" {
+			t.Error("echo came back mangled through the wrapping parser")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("echo never arrived with the injected parser")
+	}
+
+	if counting.encoded.Load() <= encodedBefore {
+		t.Error("outgoing message bypassed the injected parser's encode")
+	}
+	if counting.decoded.Load() <= decodedBefore {
+		t.Error("incoming message bypassed the injected parser's decode")
+	}
+
+	s.Close()
+	waitForClosed(t, s, 5*time.Second)
+}
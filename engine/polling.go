@@ -0,0 +1,555 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/zishang520/engine.io-go-parser/packet"
+	_types "github.com/zishang520/engine.io-go-parser/types"
+	"github.com/zishang520/engine.io/v2/log"
+	"github.com/zishang520/engine.io/v2/utils"
+
+	"github.com/zishang520/engine.io-client/request"
+)
+
+var client_polling_log = log.NewLog("engine.io-client:polling")
+
+// polling is the HTTP long-polling transport: a pending GET waits for server
+// data while writes are batched into POSTs.
+type polling struct {
+	Transport
+
+	client *request.HTTPClient
+
+	_polling atomic.Bool
+
+	// pollCtx is canceled when the transport closes, aborting the in-flight
+	// long poll; against a silent server that GET would otherwise idle out
+	// the whole poll window after the transport is already gone.
+	pollCtx    context.Context
+	pollCancel context.CancelFunc
+}
+
+// MakePolling returns a polling transport yet to be constructed.
+func MakePolling() Polling {
+	p := &polling{
+		Transport: MakeTransport(),
+	}
+
+	p.Prototype(p)
+
+	return p
+}
+
+func NewPolling(socket SocketWithoutUpgrade, opts SocketOptionsInterface) Polling {
+	p := MakePolling()
+
+	p.Construct(socket, opts)
+
+	return p
+}
+
+func (p *polling) Construct(socket SocketWithoutUpgrade, opts SocketOptionsInterface) {
+	p.Transport.Construct(socket, opts)
+
+	p.client = request.NewHTTPClient(&http.Transport{
+		TLSClientConfig: opts.TLSClientConfig(),
+		DialContext:     dialContextWithBuffers(opts),
+	}, opts.RequestTimeout())
+
+	p.pollCtx, p.pollCancel = context.WithCancel(socket.Context())
+}
+
+func (p *polling) Name() string { return "polling" }
+
+// ClearCookies drops the cookies collected for the connection's host from the
+// HTTP client's jar - session cookies after a logout, say. Affinity cookies
+// are lost too, so the next request may land on another backend.
+func (p *polling) ClearCookies() {
+	p.client.ClearCookies(p.uri())
+}
+
+func (p *polling) DoOpen() {
+	p.poll()
+}
+
+// Pause holds the transport while the socket upgrades, waiting for any
+// in-flight poll and write to settle first.
+func (p *polling) Pause(onPause func()) {
+	p.SetReadyState(TransportStatePausing)
+
+	pause := func() {
+		client_polling_log.Debug("paused")
+		p.SetReadyState(TransportStatePaused)
+		if onPause != nil {
+			onPause()
+		}
+	}
+
+	if p._polling.Load() || !p.Writable() {
+		var total atomic.Int32
+
+		if p._polling.Load() {
+			client_polling_log.Debug("we are currently polling - waiting to pause")
+			total.Add(1)
+			p.Once(EventPollComplete, func(...any) {
+				client_polling_log.Debug("pre-pause polling complete")
+				if total.Add(-1) == 0 {
+					pause()
+				}
+			})
+		}
+
+		if !p.Writable() {
+			client_polling_log.Debug("we are currently writing - waiting to pause")
+			total.Add(1)
+			p.Once(EventDrain, func(...any) {
+				client_polling_log.Debug("pre-pause writing complete")
+				if total.Add(-1) == 0 {
+					pause()
+				}
+			})
+		}
+	} else {
+		pause()
+	}
+}
+
+func (p *polling) poll() {
+	client_polling_log.Debug("polling")
+	p._polling.Store(true)
+	go p.doPoll()
+	p.Emit(EventPoll)
+}
+
+func (p *polling) doPoll() {
+	if TransportStateOpening == p.ReadyState() {
+		body, contentType, err := p.handshakeBody()
+		if err != nil {
+			p.OnError("handshake error", err, nil)
+			return
+		}
+		if body != nil {
+			res, err := p._handshakePost(body, contentType)
+			if err != nil {
+				p.OnError("handshake error", err, res)
+				return
+			}
+
+			notifyHandshakeResponse(p, res.Response.Header)
+
+			p.OnData(_types.NewStringBufferString(string(res.Data())))
+			return
+		}
+	}
+
+	headers := p.requestHeaders()
+	uri := p.uri().String()
+	started := time.Now()
+
+	// PollTimeout bounds this GET alone - long polls idle far longer than
+	// writes should be allowed to. Stream ignores the per-request Timeout,
+	// so the deadline rides on the context; it covers the body read too,
+	// since the response is consumed before this function returns.
+	ctx := p.pollCtx
+	if timeout := p.Opts().PollTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Stream rather than buffer: the headers surface as soon as they
+	// arrive, laying the ground for decoding the payload incrementally.
+	res, err := p.client.Stream(ctx, http.MethodGet, uri, &request.Options{
+		Headers:     headers,
+		Interceptor: p.Opts().RequestInterceptor(),
+	})
+	if err != nil {
+		p.recordRequest(http.MethodGet, uri, headers, 0, started, err)
+		p.OnError("xhr poll error", err, nil)
+		return
+	}
+	defer res.Close()
+
+	notifyHandshakeResponse(p, res.Header)
+
+	data, err := io.ReadAll(res.Body)
+	p.recordRequest(http.MethodGet, uri, headers, res.StatusCode, started, err)
+	if err != nil {
+		p.OnError("xhr poll error", err, res)
+		return
+	}
+
+	p.CountWireBytes(
+		httpRequestSize(http.MethodGet, uri, headers, 0),
+		httpResponseSize(res.Response, len(data)),
+	)
+
+	if !res.OK() {
+		p.OnError("xhr poll error", errors.New("xhr poll error"), res)
+		return
+	}
+
+	p.OnData(_types.NewStringBufferString(string(data)))
+}
+
+// packetLeadByte reports whether b can start an Engine.IO v4 packet: a
+// packet type digit or the base64 marker.
+func packetLeadByte(b byte) bool {
+	return (b >= '0' && b <= '6') || b == 'b'
+}
+
+func (p *polling) OnData(data _types.BufferInterface) {
+	client_polling_log.Debug("polling got data %#v", data)
+
+	// The base OnData is bypassed here, so count the payload ourselves.
+	p.CountReceived(0, uint64(data.Len()))
+
+	// A proxy rewriting the connection to another framing produces garbage
+	// here that the decoder just shrugs off; flag it explicitly first. A
+	// leading 0x81/0x82 is a telltale websocket frame header.
+	if b := data.Bytes(); len(b) > 0 && !packetLeadByte(b[0]) {
+		err := fmt.Errorf("response does not look like a polling payload (first byte 0x%02x)", b[0])
+		if b[0] == 0x81 || b[0] == 0x82 {
+			err = fmt.Errorf("response carries websocket framing on the polling transport (first byte 0x%02x)", b[0])
+		}
+		client_polling_log.Debug("transport mismatch: %v", err)
+		p.Emit(EventTransportMismatch, err)
+	}
+
+	sawNoop := false
+
+	// MaxPacketsPerBatch bounds how long this goroutine runs uninterrupted:
+	// after that many packets it yields before carrying on, so a huge
+	// payload cannot starve other goroutines. Delivery order and the poll
+	// completion below are unaffected.
+	batchLimit := p.Opts().MaxPacketsPerBatch()
+	handled := 0
+
+	packets, decodeErr := protocolParser(p.Opts()).DecodePayload(data)
+	for _, data := range packets {
+		if data == nil {
+			continue
+		}
+
+		if batchLimit > 0 && handled > 0 && handled%batchLimit == 0 {
+			runtime.Gosched()
+		}
+		handled++
+
+		// If its the first message we consider the transport open.
+		if TransportStateOpening == p.ReadyState() && data.Type == packet.OPEN {
+			p.OnOpen()
+		}
+
+		// If its a close packet, we close the ongoing requests.
+		if packet.CLOSE == data.Type {
+			p.OnClose(errors.New("transport closed by the server"))
+			return
+		}
+
+		// The server sends NOOP purely to complete this poll (kicking a
+		// pending GET during an upgrade); OnPacket accounts for it without
+		// forwarding it as application data.
+		if packet.NOOP == data.Type {
+			sawNoop = true
+		}
+
+		// Otherwise bypass onData and handle the message.
+		p.OnPacket(data)
+	}
+
+	// A malformed payload - a proxy truncating the response, say - used to
+	// be swallowed here; surface it and stop polling instead of silently
+	// dropping data. The packets decoded before the corruption were handled
+	// above.
+	if decodeErr != nil {
+		p._polling.Store(false)
+		p.OnError("decode error", decodeErr, nil)
+		return
+	}
+
+	// If an event did not trigger closing.
+	if TransportStateClosed != p.ReadyState() {
+		p._polling.Store(false)
+		p.Emit(EventPollComplete)
+
+		if TransportStateOpen == p.ReadyState() {
+			// A NOOP mid-upgrade means the server just kicked this poll so
+			// the transport can pause; starting another request now would
+			// only make the pause wait it out. Hold off until the upgrade
+			// settles and resume only when it failed.
+			if sawNoop && p.Socket().Upgrading() {
+				client_polling_log.Debug("noop received mid-upgrade - deferring next poll")
+
+				// Resume polling when the upgrade falls through; when it
+				// succeeds this transport is retired, so the deferral is
+				// unregistered rather than left to pile up on the socket
+				// across upgrades and reconnects.
+				socket := p.Socket()
+				var resume, settled func(...any)
+				resume = func(...any) {
+					socket.RemoveListener(EventUpgradeError, resume)
+					socket.RemoveListener(EventUpgradeAborted, resume)
+					socket.RemoveListener(EventUpgrade, settled)
+					if TransportStateOpen == p.ReadyState() {
+						p.poll()
+					}
+				}
+				settled = func(...any) {
+					socket.RemoveListener(EventUpgradeError, resume)
+					socket.RemoveListener(EventUpgradeAborted, resume)
+				}
+				socket.Once(EventUpgradeError, resume)
+				socket.Once(EventUpgradeAborted, resume)
+				socket.Once(EventUpgrade, settled)
+			} else {
+				p.poll()
+			}
+		} else {
+			client_polling_log.Debug(`ignoring poll - transport state "%s"`, p.ReadyState())
+		}
+	}
+}
+
+// DoClose sends a close packet, waiting for the transport to open first when
+// the close races the handshake. With a CloseTimeout configured that wait is
+// bounded: a handshake that never completes cannot hold the close forever.
+func (p *polling) DoClose() {
+	cleanup := func(...any) {
+		client_polling_log.Debug("writing close packet")
+		p.Proto().Write([]*packet.Packet{{Type: packet.CLOSE}})
+	}
+
+	if TransportStateOpen == p.ReadyState() {
+		client_polling_log.Debug("transport open - closing")
+		cleanup()
+	} else {
+		// In case we're trying to close while
+		// handshaking is in progress (GH-164).
+		client_polling_log.Debug("transport not open - deferring close")
+		p.Once(EventOpen, cleanup)
+
+		if timeout := p.Opts().CloseTimeout(); timeout > 0 {
+			utils.SetTimeout(func() {
+				if TransportStateClosed != p.ReadyState() {
+					client_polling_log.Debug("graceful close timed out - forcing")
+					p.RemoveListener(EventOpen, cleanup)
+					p.OnClose(errors.New("close timeout"))
+				}
+			}, timeout)
+		}
+	}
+}
+
+func (p *polling) Write(packets []*packet.Packet) {
+	p.SetWritable(false)
+
+	go func() {
+		// The whole batch travels in one POST: until that POST succeeds,
+		// none of it is known to have reached the server.
+		p.SetUndelivered(packets)
+
+		// A failed batch is settled too: restore writability and report the
+		// error on the drain event so the write callbacks hear about it.
+		fail := func(msg string, err error) {
+			p.OnError(msg, err, nil)
+			p.SetWritable(true)
+			p.Emit(EventDrain, err)
+		}
+
+		// Polling can only carry binary inside a base64 text payload; with
+		// RequireBinary that downgrade is an error, not a silent 33% tax.
+		if p.Opts().RequireBinary() {
+			for _, pkt := range packets {
+				if pkt.Data == nil {
+					continue
+				}
+				if _, text := pkt.Data.(*_types.StringBuffer); !text {
+					fail("binary required", errors.New("polling delivers binary payloads as base64"))
+					return
+				}
+			}
+		}
+
+		data, err := protocolParser(p.Opts()).EncodePayload(packets)
+		if err != nil {
+			fail("encode error", err)
+			return
+		}
+
+		size := uint64(data.Len())
+
+		if res, err := p._fetch(data); err != nil {
+			p.OnError("xhr post error", err, res)
+			p.SetWritable(true)
+			p.Emit(EventDrain, err)
+			return
+		}
+
+		p.CountSent(uint64(len(packets)), size)
+		p.SetUndelivered(nil)
+		p.SetWritable(true)
+		p.Emit(EventDrain)
+	}()
+}
+
+// OnClose aborts the transport's in-flight requests alongside the regular
+// teardown - after a short grace, so the best-effort close-packet POST from
+// DoClose still gets its chance to reach a live server. Without the abort, a
+// silent peer keeps the pending long poll (and that POST) pinned long after
+// the transport is gone.
+func (p *polling) OnClose(details error) {
+	grace := p.Opts().CloseTimeout()
+	if grace <= 0 {
+		grace = time.Second
+	}
+	utils.SetTimeout(p.pollCancel, grace)
+
+	p.Transport.OnClose(details)
+}
+
+// handshakeBody resolves the configured handshake POST body: the provider
+// takes precedence over the static HandshakeBody. A nil body with a nil
+// error means the standard GET handshake applies.
+func (p *polling) handshakeBody() ([]byte, string, error) {
+	if provider := p.Opts().HandshakeBodyProvider(); provider != nil {
+		reader, contentType := provider()
+		if reader == nil {
+			return nil, "", nil
+		}
+		body, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, "", &HandshakeError{Cause: err}
+		}
+		if contentType == "" {
+			contentType = p.Opts().HandshakeContentType()
+		}
+		return body, contentType, nil
+	}
+
+	if body := p.Opts().HandshakeBody(); body != nil {
+		return body, p.Opts().HandshakeContentType(), nil
+	}
+
+	return nil, "", nil
+}
+
+// _handshakePost sends the initial request as a POST carrying the
+// user-supplied body (see SocketOptions.HandshakeBody and
+// HandshakeBodyProvider) instead of the standard GET, for servers that
+// demand a credential exchange up front. The response is parsed like any
+// other poll payload; failures come back as *HandshakeError with the
+// server's response details.
+func (p *polling) _handshakePost(body []byte, contentType string) (*request.Response, error) {
+	headers := p.requestHeaders()
+	headers.Set("Content-Type", contentType)
+
+	uri := p.uri().String()
+	started := time.Now()
+
+	res, err := p.client.Post(uri, &request.Options{
+		Context:     p.pollCtx,
+		Headers:     headers,
+		Body:        bytes.NewReader(body),
+		Interceptor: p.Opts().RequestInterceptor(),
+	})
+	if err != nil {
+		p.recordRequest(http.MethodPost, uri, headers, 0, started, err)
+		return res, &HandshakeError{Cause: err}
+	}
+	p.recordRequest(http.MethodPost, uri, headers, res.StatusCode, started, nil)
+
+	p.CountWireBytes(
+		httpRequestSize(http.MethodPost, uri, headers, len(body)),
+		httpResponseSize(res.Response, len(res.Data())),
+	)
+	if !res.OK() {
+		return res, &HandshakeError{
+			Cause:      errors.New("handshake rejected by server"),
+			StatusCode: res.StatusCode,
+			Body:       res.Data(),
+		}
+	}
+	return res, nil
+}
+
+// _fetch POSTs an encoded payload to the server.
+func (p *polling) _fetch(data _types.BufferInterface) (*request.Response, error) {
+	headers := p.requestHeaders()
+	headers.Set("Content-Type", "text/plain;charset=UTF-8")
+
+	uri := p.uri().String()
+	body := data.String()
+	started := time.Now()
+
+	res, err := p.client.Post(uri, &request.Options{
+		Context: p.pollCtx,
+		Headers: headers,
+		Body:    strings.NewReader(body),
+		// WriteTimeout fails the POST fast instead of letting it hang for
+		// the long-poll window; zero falls through to the client default.
+		Timeout:     p.Opts().WriteTimeout(),
+		Interceptor: p.Opts().RequestInterceptor(),
+	})
+	if err != nil {
+		p.recordRequest(http.MethodPost, uri, headers, 0, started, err)
+	} else {
+		p.recordRequest(http.MethodPost, uri, headers, res.StatusCode, started, nil)
+	}
+	if err == nil {
+		p.CountWireBytes(
+			httpRequestSize(http.MethodPost, uri, headers, len(body)),
+			httpResponseSize(res.Response, len(res.Data())),
+		)
+		if !res.OK() {
+			err = errors.New("xhr post error")
+		}
+	}
+	return res, err
+}
+
+// recordRequest mirrors one HTTP request into the capture when a Recorder is
+// configured; see SocketOptions.Recorder.
+func (p *polling) recordRequest(method string, uri string, headers http.Header, status int, started time.Time, err error) {
+	if rec := p.Opts().Recorder(); rec != nil {
+		rec.RecordRequest(method, uri, headers, status, time.Since(started), err)
+	}
+}
+
+// requestHeaders builds the headers sent with every HTTP request; see the
+// package-level requestHeaders for the merge order.
+func (p *polling) requestHeaders() http.Header {
+	return requestHeaders(p.Opts())
+}
+
+func (p *polling) uri() *url.URL {
+	schema := "http"
+	if p.Opts().Secure() {
+		schema = "https"
+	}
+
+	query := url.Values{}
+	for key, values := range p.Query() {
+		query[key] = values
+	}
+
+	if p.Opts().TimestampRequests() {
+		query.Set(p.Opts().TimestampParam(), cacheBuster(p.Opts()))
+	}
+
+	if !p.SupportsBinary() {
+		query.Set("b64", "1")
+	}
+
+	return p.CreateUri(schema, query)
+}
@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	"github.com/zishang520/engine.io/v2/events"
+)
+
+// brokenProxyServer answers the polling handshake, advertises a websocket
+// upgrade, and then swallows the probe: the websocket endpoint upgrades the
+// connection but never answers anything - the behavior of a proxy that
+// forwards the HTTP upgrade and drops the frames.
+func brokenProxyServer(t *testing.T) string {
+	t.Helper()
+
+	upgrader := ws.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	hang := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}
+		if r.Method == http.MethodGet && !strings.Contains(r.URL.RawQuery, "sid=") {
+			w.Write([]byte(`0{"sid":"proxy","upgrades":["websocket"],"pingInterval":300000,"pingTimeout":300000,"maxPayload":1000000}`))
+			return
+		}
+		select { // long poll with nothing to say
+		case <-hang:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(func() {
+		close(hang)
+		ts.Close()
+	})
+
+	return ts.URL
+}
+
+// TestProbeTimeoutReleasesResources lets an upgrade probe run into a server
+// that never answers it and checks the timeout cleans up completely: an
+// upgradeError with a timeout cause, the probe listeners gone from the
+// socket, and no goroutines left behind.
+func TestProbeTimeoutReleasesResources(t *testing.T) {
+	url := brokenProxyServer(t)
+
+	baselineGoroutines := runtime.NumGoroutine()
+
+	opts := DefaultSocketOptions()
+	opts.SetProbeTimeout(300 * time.Millisecond)
+
+	s := NewSocket(url, opts)
+	probeErrs := make(chan *Error, 1)
+	s.On(EventUpgradeError, func(args ...any) {
+		if len(args) > 0 {
+			if err, ok := args[0].(*Error); ok {
+				select {
+				case probeErrs <- err:
+				default:
+				}
+			}
+		}
+	})
+
+	// The probe's own Once listeners ride on these events; note what is
+	// registered before any probe starts.
+	preProbe := map[events.EventName]int{}
+	for _, evt := range []events.EventName{EventClose, EventUpgrading} {
+		preProbe[evt] = s.ListenerCount(evt)
+	}
+
+	waitForEvent(t, s, EventOpen, 5*time.Second)
+
+	select {
+	case err := <-probeErrs:
+		var timeoutErr *TimeoutError
+		if !errors.As(err.Description, &timeoutErr) {
+			t.Errorf("upgradeError cause = %v, want a *TimeoutError", err.Description)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("probe never timed out")
+	}
+
+	// Cleanup runs inside the timeout path; give the emitter a beat.
+	time.Sleep(100 * time.Millisecond)
+	for evt, count := range preProbe {
+		if got := s.ListenerCount(evt); got > count+1 { // +1 for our own wiring
+			t.Errorf("listener count for %q grew from %d to %d after the probe", evt, count, got)
+		}
+	}
+
+	s.Close()
+	waitForClosed(t, s, 5*time.Second)
+
+	// The candidate transport and its goroutines must be gone with it.
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if runtime.NumGoroutine() <= baselineGoroutines+2 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if got := runtime.NumGoroutine(); got > baselineGoroutines+2 {
+		t.Errorf("goroutines grew from %d to %d after the probe timeout", baselineGoroutines, got)
+	}
+}
@@ -0,0 +1,233 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_types "github.com/zishang520/engine.io-go-parser/types"
+	"github.com/zishang520/engine.io/v2/types"
+)
+
+// forwardingProxy starts a proxy in front of base whose handler first offers
+// each request to intercept; a true return means the interceptor handled it,
+// anything else is forwarded verbatim.
+func forwardingProxy(t *testing.T, base string, intercept func(http.ResponseWriter, *http.Request) bool) string {
+	t.Helper()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if intercept != nil && intercept(w, r) {
+			return
+		}
+		target := base + r.URL.Path
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		var body []byte
+		if r.Body != nil {
+			body, _ = io.ReadAll(r.Body)
+		}
+		req, err := http.NewRequestWithContext(r.Context(), r.Method, target, bytes.NewReader(body))
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		req.Header = r.Header.Clone()
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer res.Body.Close()
+		for key, values := range res.Header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(res.StatusCode)
+		io.Copy(w, res.Body)
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts.URL
+}
+
+// reconnectedSocket opens a socket with reconnection armed, kills the session
+// the way a dying transport would, and waits for the scheduled reconnect to
+// land - the state every assertion about a revived socket starts from.
+func reconnectedSocket(t *testing.T, ctx context.Context, url string, opts SocketOptionsInterface) Socket {
+	t.Helper()
+
+	opts.SetReconnection(true)
+	opts.SetReconnectionDelay(50 * time.Millisecond)
+	opts.SetRandomizationFactor(0)
+
+	var s Socket
+	if ctx != nil {
+		s = NewSocketContext(ctx, url, opts)
+	} else {
+		s = NewSocket(url, opts)
+	}
+	t.Cleanup(func() { s.Close() })
+	waitForEvent(t, s, EventOpen, 5*time.Second)
+
+	s.OnClose("transport close", errors.New("simulated transport death"))
+	waitForEvent(t, s, EventOpen, 5*time.Second)
+
+	return s
+}
+
+// TestReconnectKeepsContextCancellation checks a bound context still closes
+// the socket after a reconnect: the watcher of the first attempt exits with
+// it, so the revived session needs one of its own.
+func TestReconnectKeepsContextCancellation(t *testing.T) {
+	url := newTestServer(t, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := reconnectedSocket(t, ctx, url, pollingOnly())
+
+	cancel()
+	waitForClosed(t, s, 5*time.Second)
+	if got := s.ReadyState(); got != SocketStateClosed {
+		t.Errorf("socket state after cancellation = %q, want closed", got)
+	}
+}
+
+// TestReconnectKeepsBlockingSenders checks the BlockOnBufferFull path still
+// blocks on a reconnected socket instead of failing with ErrSocketClosed the
+// moment the buffer fills.
+func TestReconnectKeepsBlockingSenders(t *testing.T) {
+	url := newTestServer(t, nil)
+
+	opts := pollingOnly()
+	opts.SetMaxBufferedPackets(1)
+	opts.SetBlockOnBufferFull(true)
+	s := reconnectedSocket(t, nil, url, opts)
+
+	// The first write sits in the buffer while its POST is in flight, so
+	// the follow-ups hit the full buffer and must block until it drains.
+	for i := 0; i < 5; i++ {
+		if err := s.TryWrite(_types.NewStringBufferString("backpressure"), nil, nil); err != nil {
+			t.Fatalf("write %d on the reconnected open socket: %v", i, err)
+		}
+	}
+}
+
+// TestReconnectKeepsCloseContext wedges a reconnected socket's writes and
+// checks CloseContext still waits for the close instead of returning nil
+// straight away on the spent done signal of the first session.
+func TestReconnectKeepsCloseContext(t *testing.T) {
+	base := newTestServer(t, nil)
+
+	var blackhole atomic.Bool
+	url := forwardingProxy(t, base, func(w http.ResponseWriter, r *http.Request) bool {
+		if blackhole.Load() {
+			// Drain the body so the server's background read can notice the
+			// client aborting; with unread body bytes buffered it would never
+			// cancel r.Context() and the handler would outlive the test.
+			io.Copy(io.Discard, r.Body)
+			<-r.Context().Done()
+			return true
+		}
+		return false
+	})
+
+	s := reconnectedSocket(t, nil, url, pollingOnly())
+
+	// Swallow everything from here on; the next write can never drain, so a
+	// graceful close cannot complete and the deadline has to force it.
+	blackhole.Store(true)
+	s.SendString("never drains")
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	err := s.CloseContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CloseContext = %v after %v, want the deadline to force the close", err, time.Since(started))
+	}
+	if elapsed := time.Since(started); elapsed < 300*time.Millisecond {
+		t.Errorf("CloseContext returned after %v without waiting for the close", elapsed)
+	}
+	if got := s.ReadyState(); got != SocketStateClosed {
+		t.Errorf("socket state after the forced close = %q, want closed", got)
+	}
+}
+
+// rememberedUpgradeOptions returns options that take the RememberUpgrade
+// websocket shortcut on open, with the upgrade machinery off so the polling
+// fallback stays on polling.
+func rememberedUpgradeOptions() *SocketOptions {
+	opts := DefaultSocketOptions()
+	opts.SetTransports(types.NewSet("polling", "websocket"))
+	opts.SetRememberUpgrade(true)
+	opts.SetUpgrade(false)
+	return opts
+}
+
+// TestRememberedUpgradeFallbackKeepsLifecycle forces the remembered-websocket
+// shortcut to fail so the socket falls back to polling, then checks the
+// fallback-connected socket still honors a bound context and CloseContext:
+// the failed first attempt already closed its done signal once, and the
+// fallback open must not leave the socket running on that spent one.
+func TestRememberedUpgradeFallbackKeepsLifecycle(t *testing.T) {
+	base := newTestServer(t, nil)
+
+	// Reject websocket handshakes so the shortcut attempt dies before open.
+	var wsAttempts atomic.Int64
+	url := forwardingProxy(t, base, func(w http.ResponseWriter, r *http.Request) bool {
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			wsAttempts.Add(1)
+			w.WriteHeader(http.StatusBadRequest)
+			return true
+		}
+		return false
+	})
+
+	priorWebsocketSuccess.Store(true)
+	t.Cleanup(func() { priorWebsocketSuccess.Store(false) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := NewSocketContext(ctx, url, rememberedUpgradeOptions())
+	t.Cleanup(func() { s.Close() })
+
+	waitForEvent(t, s, EventOpen, 5*time.Second)
+	if wsAttempts.Load() == 0 {
+		t.Fatal("no websocket attempt observed - the RememberUpgrade shortcut was not taken")
+	}
+	if got := s.TransportName(); got != "polling" {
+		t.Errorf("transport after the fallback = %q, want polling", got)
+	}
+
+	cancel()
+	waitForClosed(t, s, 5*time.Second)
+	if got := s.ReadyState(); got != SocketStateClosed {
+		t.Errorf("socket state after cancellation = %q, want closed", got)
+	}
+
+	// Same fallback again, this time closed through CloseContext: nil must
+	// mean the close actually happened, not that the first attempt's spent
+	// done signal answered straight away.
+	priorWebsocketSuccess.Store(true)
+	s2 := NewSocket(url, rememberedUpgradeOptions())
+	t.Cleanup(func() { s2.Close() })
+	waitForEvent(t, s2, EventOpen, 5*time.Second)
+
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelClose()
+	if err := s2.CloseContext(closeCtx); err != nil {
+		t.Fatalf("CloseContext on the fallback-connected socket: %v", err)
+	}
+	if got := s2.ReadyState(); got != SocketStateClosed {
+		t.Errorf("socket state after CloseContext = %q, want closed", got)
+	}
+}
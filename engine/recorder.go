@@ -0,0 +1,277 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/zishang520/engine.io-go-parser/packet"
+	_types "github.com/zishang520/engine.io-go-parser/types"
+	"github.com/zishang520/engine.io/v2/events"
+)
+
+// Record kinds, one per observation class of a capture.
+const (
+	RecordKindState   = "state"
+	RecordKindPacket  = "packet"
+	RecordKindRequest = "request"
+	RecordKindEvent   = "event"
+)
+
+// Packet record directions.
+const (
+	RecordDirectionIn  = "in"
+	RecordDirectionOut = "out"
+)
+
+// ReplayRecord is one line of a capture written by a Recorder: a timestamped
+// observation of the socket. Only the fields of the record's kind are set;
+// the rest are omitted from the JSON encoding.
+type ReplayRecord struct {
+	Time time.Time `json:"ts"`
+	Kind string    `json:"kind"`
+
+	// state records: the readyState transition.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+
+	// packet records. Hash is the hex-truncated SHA-256 of the payload, so
+	// payload-less captures still allow correlating packets across runs;
+	// Payload is only present with IncludePayloads.
+	Direction  string `json:"dir,omitempty"`
+	PacketType string `json:"packetType,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	Binary     bool   `json:"binary,omitempty"`
+	Hash       string `json:"hash,omitempty"`
+	Payload    []byte `json:"payload,omitempty"`
+
+	// request records. Status is zero when the request never completed;
+	// Error then carries the reason.
+	Method     string      `json:"method,omitempty"`
+	URL        string      `json:"url,omitempty"`
+	Status     int         `json:"status,omitempty"`
+	DurationMs int64       `json:"durationMs,omitempty"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Error      string      `json:"error,omitempty"`
+
+	// event records: the event name and its argument count.
+	Event string `json:"event,omitempty"`
+	Args  int    `json:"args,omitempty"`
+}
+
+// Recorder captures a socket's observable behavior - state transitions,
+// packets in both directions, HTTP requests and event emissions - as
+// newline-delimited JSON, one ReplayRecord per line, so protocol-level bug
+// reports can ship a replayable trace. Attach it via SocketOptions.Recorder
+// before the socket is constructed; it is safe for concurrent use. The first
+// write error silences the recorder for good rather than failing the
+// connection.
+type Recorder struct {
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+
+	// IncludePayloads embeds packet payloads in the capture. Off by default:
+	// payloads may carry user data, and size plus hash is usually enough to
+	// correlate. Replaying decode paths requires payloads.
+	IncludePayloads bool
+
+	// IncludeHeaders embeds request headers in request records, after
+	// RedactHeaders had its say. Off by default for the same reason.
+	IncludeHeaders bool
+
+	// RedactQuery, when set, rewrites the query parameters of every recorded
+	// URL - strip or mask tokens before a capture leaves the machine. It is
+	// called with a copy; the request itself is untouched.
+	RedactQuery func(url.Values) url.Values
+
+	// RedactHeaders is the header counterpart of RedactQuery, consulted only
+	// with IncludeHeaders set. It is called with a copy.
+	RedactHeaders func(http.Header) http.Header
+}
+
+// NewRecorder returns a Recorder writing its capture to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Err returns the write or encoding error that silenced the recorder, nil
+// while it is still recording.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
+
+func (r *Recorder) write(record *ReplayRecord) {
+	record.Time = time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		r.err = err
+		return
+	}
+	if _, err := r.w.Write(append(line, '\n')); err != nil {
+		r.err = err
+	}
+}
+
+// RecordState notes a readyState transition.
+func (r *Recorder) RecordState(old SocketState, new SocketState) {
+	r.write(&ReplayRecord{
+		Kind: RecordKindState,
+		From: string(old),
+		To:   string(new),
+	})
+}
+
+// RecordPacket notes one packet crossing the socket in the given direction.
+func (r *Recorder) RecordPacket(direction string, pkt *packet.Packet) {
+	if pkt == nil {
+		return
+	}
+
+	record := &ReplayRecord{
+		Kind:       RecordKindPacket,
+		Direction:  direction,
+		PacketType: string(pkt.Type),
+	}
+
+	if buf, ok := pkt.Data.(_types.BufferInterface); ok && buf != nil {
+		data := buf.Bytes()
+		sum := sha256.Sum256(data)
+		record.Size = int64(len(data))
+		record.Hash = hex.EncodeToString(sum[:8])
+		_, isString := buf.(*_types.StringBuffer)
+		record.Binary = !isString
+		if r.IncludePayloads {
+			record.Payload = append([]byte(nil), data...)
+		}
+	}
+
+	r.write(record)
+}
+
+// RecordRequest notes one HTTP request of the polling transport. The URL's
+// query is passed through RedactQuery; status is zero and reqErr non-nil when
+// the request never completed.
+func (r *Recorder) RecordRequest(method string, rawURL string, headers http.Header, status int, duration time.Duration, reqErr error) {
+	record := &ReplayRecord{
+		Kind:       RecordKindRequest,
+		Method:     method,
+		URL:        r.redactURL(rawURL),
+		Status:     status,
+		DurationMs: duration.Milliseconds(),
+	}
+	if reqErr != nil {
+		record.Error = reqErr.Error()
+	}
+	if r.IncludeHeaders && headers != nil {
+		copied := http.Header{}
+		for key, values := range headers {
+			copied[key] = append([]string(nil), values...)
+		}
+		if r.RedactHeaders != nil {
+			copied = r.RedactHeaders(copied)
+		}
+		record.Headers = copied
+	}
+
+	r.write(record)
+}
+
+// RecordEvent notes one event emission.
+func (r *Recorder) RecordEvent(name events.EventName, argc int) {
+	r.write(&ReplayRecord{
+		Kind:  RecordKindEvent,
+		Event: string(name),
+		Args:  argc,
+	})
+}
+
+func (r *Recorder) redactURL(rawURL string) string {
+	if r.RedactQuery == nil {
+		return rawURL
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	query := url.Values{}
+	for key, values := range parsed.Query() {
+		query[key] = append([]string(nil), values...)
+	}
+	parsed.RawQuery = r.RedactQuery(query).Encode()
+
+	return parsed.String()
+}
+
+// recordedEvents is the set of socket events mirrored into a capture. Packets
+// get their own richer records, so "packet" is absent here.
+var recordedEvents = []events.EventName{
+	EventOpen,
+	EventHandshake,
+	EventRawHandshake,
+	EventClose,
+	EventError,
+	EventMessage,
+	EventHeartbeat,
+	EventPing,
+	EventPong,
+	EventFlush,
+	EventDrain,
+	EventUpgrading,
+	EventUpgrade,
+	EventUpgradeError,
+	EventUpgradeAborted,
+	EventUpgradesFiltered,
+	EventTransportDegraded,
+	EventTransportDowngrade,
+	EventTransportRefresh,
+	EventTransportChange,
+	EventTransportMismatch,
+	EventDatagram,
+	EventDatagramUnavailable,
+	EventNoop,
+	EventEvicted,
+	EventReconnectScheduled,
+	EventReconnectFailed,
+}
+
+// attachRecorder subscribes rec to the socket's observable surface. Outgoing
+// packets are recorded in Flush, requests in the polling transport.
+func (s *socketWithoutUpgrade) attachRecorder(rec *Recorder) {
+	s.OnStateChange(func(old SocketState, new SocketState) {
+		rec.RecordState(old, new)
+	})
+
+	s.On(EventPacket, func(args ...any) {
+		if len(args) > 0 {
+			if pkt, ok := args[0].(*packet.Packet); ok {
+				rec.RecordPacket(RecordDirectionIn, pkt)
+			}
+		}
+	})
+
+	for _, name := range recordedEvents {
+		name := name
+		s.On(name, func(args ...any) {
+			rec.RecordEvent(name, len(args))
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	_types "github.com/zishang520/engine.io-go-parser/types"
+)
+
+// hangingServer accepts connections but never answers, keeping a socket stuck
+// in the opening state for the duration of the test.
+func hangingServer(t *testing.T) string {
+	t.Helper()
+
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		<-release
+	}))
+	t.Cleanup(func() {
+		close(release)
+		ts.Close()
+	})
+
+	return ts.URL
+}
+
+// TestPanickingWriteCallbackKeepsDraining panics inside a send callback and
+// checks the drain pipeline survives: the panic surfaces as an error event
+// and subsequent sends still settle normally.
+func TestPanickingWriteCallbackKeepsDraining(t *testing.T) {
+	url := newTestServer(t, nil)
+	s := openSocket(t, url, pollingOnly())
+
+	panicked := make(chan *Error, 1)
+	OnError(s, func(err *Error) {
+		if err.Message == "write callback panic" {
+			select {
+			case panicked <- err:
+			default:
+			}
+		}
+	})
+
+	s.Send(_types.NewStringBufferString("first"), nil, func() {
+		panic("callback gone wrong")
+	})
+
+	select {
+	case err := <-panicked:
+		if err.Description == nil || !strings.Contains(err.Description.Error(), "callback gone wrong") {
+			t.Errorf("panic error should carry the panic value and stack, got %v", err.Description)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback panic never surfaced as an error event")
+	}
+
+	// The writer goroutines must still be alive: later sends drain and their
+	// callbacks run.
+	settled := make(chan struct{})
+	s.Send(_types.NewStringBufferString("second"), nil, func() { close(settled) })
+	select {
+	case <-settled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("send after a panicking callback never drained")
+	}
+}
+
+// TestSendHelperPacketTypes checks each convenience sender queues the buffer
+// flavor the transport will frame accordingly: text for SendString, binary
+// for SendBytes and SendReader. The server never completes the handshake, so
+// the packets stay inspectable in the write buffer.
+func TestSendHelperPacketTypes(t *testing.T) {
+	s := NewSocket(hangingServer(t), pollingOnly())
+	t.Cleanup(func() { s.Close() })
+
+	s.SendString("text")
+	s.SendBytes([]byte{0x0F, 0xF0})
+	s.SendReader(strings.NewReader("streamed"))
+
+	buffer := s.WriteBuffer()
+	if len(buffer) != 3 {
+		t.Fatalf("write buffer holds %d packets, want 3", len(buffer))
+	}
+
+	if _, ok := buffer[0].Data.(*_types.StringBuffer); !ok {
+		t.Errorf("SendString queued %T, want a string buffer", buffer[0].Data)
+	}
+	for i, name := range map[int]string{1: "SendBytes", 2: "SendReader"} {
+		if _, ok := buffer[i].Data.(*_types.StringBuffer); ok {
+			t.Errorf("%s queued a string buffer, want binary", name)
+		}
+		if _, ok := buffer[i].Data.(_types.BufferInterface); !ok {
+			t.Errorf("%s queued %T, want a materialized buffer", name, buffer[i].Data)
+		}
+	}
+	if got := buffer[2].Data.(_types.BufferInterface).String(); got != "streamed" {
+		t.Errorf("SendReader queued %q, want the reader's content", got)
+	}
+}
+
+// TestUpgradesInspectionAndClear covers the Upgrades/AvailableUpgrades
+// getters and ClearUpgrades semantics, with the probes themselves disabled so
+// the set stays put for inspection.
+func TestUpgradesInspectionAndClear(t *testing.T) {
+	url := newTestServer(t, nil)
+
+	opts := DefaultSocketOptions()
+	opts.SetUpgrade(false)
+	s := openSocket(t, url, opts)
+
+	upgrades := s.Upgrades()
+	if len(upgrades) != 1 || upgrades[0] != "websocket" {
+		t.Fatalf("Upgrades() = %v, want [websocket]", upgrades)
+	}
+
+	// The returned slice is a copy: scribbling on it must not leak back.
+	upgrades[0] = "carrier-pigeon"
+	if got := s.Upgrades(); len(got) != 1 || got[0] != "websocket" {
+		t.Errorf("mutating the returned slice changed the internal set: %v", got)
+	}
+
+	s.ClearUpgrades()
+	if got := s.Upgrades(); len(got) != 0 {
+		t.Errorf("Upgrades() after ClearUpgrades = %v, want empty", got)
+	}
+	if got := s.AvailableUpgrades(); len(got) != 1 || got[0] != "websocket" {
+		t.Errorf("AvailableUpgrades() should survive ClearUpgrades, got %v", got)
+	}
+	if err := s.ProbeUpgrade("websocket"); err == nil {
+		t.Errorf("ProbeUpgrade should refuse a cleared upgrade")
+	}
+}
@@ -0,0 +1,1751 @@
+package engine
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/zishang520/engine.io-go-parser/packet"
+	"github.com/zishang520/engine.io-go-parser/parser"
+	"github.com/zishang520/engine.io/v2/types"
+)
+
+// PerMessageDeflate holds the client-side knobs of the WebSocket
+// permessage-deflate extension.
+type PerMessageDeflate struct {
+	// Threshold is the number of bytes below which an outgoing message is
+	// not worth compressing.
+	Threshold int
+}
+
+// SubprotocolToken is the configuration behind SetTokenViaSubprotocol: Token
+// supplies the credential - re-invoked on every connection attempt, so
+// rotated tokens are picked up - and Prefix is prepended to it to form the
+// subprotocol entry offered on the websocket dial.
+type SubprotocolToken struct {
+	Prefix string
+	Token  func() string
+}
+
+// SocketOptionsInterface is the read/write surface of SocketOptions. Each
+// option comes as a triple: a value getter applying the zero default, a raw
+// getter exposing whether the option was set at all, and a setter.
+type SocketOptionsInterface interface {
+	Host() string
+	GetRawHost() *string
+	SetHost(string)
+
+	Hostname() string
+	GetRawHostname() *string
+	SetHostname(string)
+
+	Secure() bool
+	GetRawSecure() *bool
+	SetSecure(bool)
+
+	Port() string
+	GetRawPort() *string
+	SetPort(string)
+
+	Query() url.Values
+	GetRawQuery() url.Values
+	SetQuery(url.Values)
+
+	Upgrade() bool
+	GetRawUpgrade() *bool
+	SetUpgrade(bool)
+
+	ForceBase64() bool
+	GetRawForceBase64() *bool
+	SetForceBase64(bool)
+
+	TimestampParam() string
+	GetRawTimestampParam() *string
+	SetTimestampParam(string)
+
+	TimestampRequests() bool
+	GetRawTimestampRequests() *bool
+	SetTimestampRequests(bool)
+
+	CacheBusterStrategy() CacheBusterStrategy
+	GetRawCacheBusterStrategy() *CacheBusterStrategy
+	SetCacheBusterStrategy(CacheBusterStrategy)
+
+	Transports() *types.Set[string]
+	GetRawTransports() *types.Set[string]
+	SetTransports(*types.Set[string])
+
+	RequestTimeout() time.Duration
+	GetRawRequestTimeout() *time.Duration
+	SetRequestTimeout(time.Duration)
+
+	PollTimeout() time.Duration
+	GetRawPollTimeout() *time.Duration
+	SetPollTimeout(time.Duration)
+
+	WriteTimeout() time.Duration
+	GetRawWriteTimeout() *time.Duration
+	SetWriteTimeout(time.Duration)
+
+	TLSClientConfig() *tls.Config
+	GetRawTLSClientConfig() *tls.Config
+	SetTLSClientConfig(*tls.Config)
+
+	ExtraHeaders() http.Header
+	GetRawExtraHeaders() http.Header
+	SetExtraHeaders(http.Header)
+
+	ExtraHeadersFn() func() http.Header
+	GetRawExtraHeadersFn() func() http.Header
+	SetExtraHeadersFn(func() http.Header)
+
+	RequestInterceptor() func(*http.Request) error
+	GetRawRequestInterceptor() func(*http.Request) error
+	SetRequestInterceptor(func(*http.Request) error)
+
+	Path() string
+	GetRawPath() *string
+	SetPath(string)
+
+	AddTrailingSlash() bool
+	GetRawAddTrailingSlash() *bool
+	SetAddTrailingSlash(bool)
+
+	ProtocolVersion() int
+	GetRawProtocolVersion() *int
+	SetProtocolVersion(int)
+
+	Parser() parser.Parser
+	GetRawParser() parser.Parser
+	SetParser(parser.Parser)
+
+	Protocols() []string
+	GetRawProtocols() []string
+	SetProtocols([]string)
+
+	PerMessageDeflate() *PerMessageDeflate
+	GetRawPerMessageDeflate() *PerMessageDeflate
+	SetPerMessageDeflate(*PerMessageDeflate)
+
+	MetricsHook() func(TransportStats)
+	GetRawMetricsHook() func(TransportStats)
+	SetMetricsHook(func(TransportStats))
+
+	NetDialContext() func(ctx context.Context, network string, addr string) (net.Conn, error)
+	GetRawNetDialContext() func(ctx context.Context, network string, addr string) (net.Conn, error)
+	SetNetDialContext(func(ctx context.Context, network string, addr string) (net.Conn, error))
+
+	NetDial() func(network string, addr string) (net.Conn, error)
+	GetRawNetDial() func(network string, addr string) (net.Conn, error)
+	SetNetDial(func(network string, addr string) (net.Conn, error))
+
+	CloseTimeout() time.Duration
+	GetRawCloseTimeout() *time.Duration
+	SetCloseTimeout(time.Duration)
+
+	SynchronousWrites() bool
+	GetRawSynchronousWrites() *bool
+	SetSynchronousWrites(bool)
+
+	TransportErrorThreshold() float64
+	GetRawTransportErrorThreshold() *float64
+	SetTransportErrorThreshold(float64)
+
+	PayloadCodec() PayloadCodec
+	GetRawPayloadCodec() PayloadCodec
+	SetPayloadCodec(PayloadCodec)
+
+	PayloadCodecThreshold() int
+	GetRawPayloadCodecThreshold() *int
+	SetPayloadCodecThreshold(int)
+
+	WriteLockTimeout() time.Duration
+	GetRawWriteLockTimeout() *time.Duration
+	SetWriteLockTimeout(time.Duration)
+
+	UserAgent() string
+	GetRawUserAgent() *string
+	SetUserAgent(string)
+
+	OnHandshakeResponse() func(http.Header)
+	GetRawOnHandshakeResponse() func(http.Header)
+	SetOnHandshakeResponse(func(http.Header))
+
+	RepanicWriteCallbacks() bool
+	GetRawRepanicWriteCallbacks() *bool
+	SetRepanicWriteCallbacks(bool)
+
+	HandshakeBody() []byte
+	GetRawHandshakeBody() []byte
+	SetHandshakeBody([]byte)
+
+	HandshakeContentType() string
+	GetRawHandshakeContentType() *string
+	SetHandshakeContentType(string)
+
+	HandshakeBodyProvider() func() (io.Reader, string)
+	GetRawHandshakeBodyProvider() func() (io.Reader, string)
+	SetHandshakeBodyProvider(func() (io.Reader, string))
+
+	RequireBinary() bool
+	GetRawRequireBinary() *bool
+	SetRequireBinary(bool)
+
+	SocketReadBuffer() int
+	GetRawSocketReadBuffer() *int
+	SetSocketReadBuffer(int)
+
+	SocketWriteBuffer() int
+	GetRawSocketWriteBuffer() *int
+	SetSocketWriteBuffer(int)
+
+	MaxBufferedPackets() int
+	GetRawMaxBufferedPackets() *int
+	SetMaxBufferedPackets(int)
+
+	MaxBufferedBytes() int64
+	GetRawMaxBufferedBytes() *int64
+	SetMaxBufferedBytes(int64)
+
+	BlockOnBufferFull() bool
+	GetRawBlockOnBufferFull() *bool
+	SetBlockOnBufferFull(bool)
+
+	MaxPayload() int
+	GetRawMaxPayload() *int
+	SetMaxPayload(int)
+
+	Recorder() *Recorder
+	GetRawRecorder() *Recorder
+	SetRecorder(*Recorder)
+
+	AllowedUpgrades() map[string][]string
+	GetRawAllowedUpgrades() map[string][]string
+	SetAllowedUpgrades(map[string][]string)
+
+	FlushInterval() time.Duration
+	GetRawFlushInterval() *time.Duration
+	SetFlushInterval(time.Duration)
+
+	FlushMaxPackets() int
+	GetRawFlushMaxPackets() *int
+	SetFlushMaxPackets(int)
+
+	FlushMaxBytes() int64
+	GetRawFlushMaxBytes() *int64
+	SetFlushMaxBytes(int64)
+
+	UpgradeProbeDelay() time.Duration
+	GetRawUpgradeProbeDelay() *time.Duration
+	SetUpgradeProbeDelay(time.Duration)
+
+	PingTimeoutGrace() time.Duration
+	GetRawPingTimeoutGrace() *time.Duration
+	SetPingTimeoutGrace(time.Duration)
+
+	TokenViaSubprotocol() *SubprotocolToken
+	GetRawTokenViaSubprotocol() *SubprotocolToken
+	SetTokenViaSubprotocol(string, func() string)
+
+	Reconnection() bool
+	GetRawReconnection() *bool
+	SetReconnection(bool)
+
+	ReconnectionDelay() time.Duration
+	GetRawReconnectionDelay() *time.Duration
+	SetReconnectionDelay(time.Duration)
+
+	ReconnectionDelayMax() time.Duration
+	GetRawReconnectionDelayMax() *time.Duration
+	SetReconnectionDelayMax(time.Duration)
+
+	RandomizationFactor() float64
+	GetRawRandomizationFactor() *float64
+	SetRandomizationFactor(float64)
+
+	MaxReconnectionAttempts() int
+	GetRawMaxReconnectionAttempts() *int
+	SetMaxReconnectionAttempts(int)
+
+	MaxConcurrentWrites() int
+	GetRawMaxConcurrentWrites() *int
+	SetMaxConcurrentWrites(int)
+
+	MaxPacketsPerBatch() int
+	GetRawMaxPacketsPerBatch() *int
+	SetMaxPacketsPerBatch(int)
+
+	ReadErrorPolicy() func(error) bool
+	GetRawReadErrorPolicy() func(error) bool
+	SetReadErrorPolicy(func(error) bool)
+
+	MaxConsecutiveReadErrors() int
+	GetRawMaxConsecutiveReadErrors() *int
+	SetMaxConsecutiveReadErrors(int)
+
+	OpenTimeout() time.Duration
+	GetRawOpenTimeout() *time.Duration
+	SetOpenTimeout(time.Duration)
+
+	ProbeTimeout() time.Duration
+	GetRawProbeTimeout() *time.Duration
+	SetProbeTimeout(time.Duration)
+
+	PingTimeoutJitter() float64
+	GetRawPingTimeoutJitter() *float64
+	SetPingTimeoutJitter(float64)
+
+	DowngradeAfterPingTimeouts() int
+	GetRawDowngradeAfterPingTimeouts() *int
+	SetDowngradeAfterPingTimeouts(int)
+
+	RememberUpgrade() bool
+	GetRawRememberUpgrade() *bool
+	SetRememberUpgrade(bool)
+
+	TransportOptions() map[string]SocketOptionsInterface
+	GetRawTransportOptions() map[string]SocketOptionsInterface
+	SetTransportOptions(map[string]SocketOptionsInterface)
+
+	SelectInitialTransport() func(available []string) string
+	GetRawSelectInitialTransport() func(available []string) string
+	SetSelectInitialTransport(func(available []string) string)
+
+	WebTransportRouting() func(*packet.Packet) bool
+	GetRawWebTransportRouting() func(*packet.Packet) bool
+	SetWebTransportRouting(func(*packet.Packet) bool)
+
+	HandshakePacketTimeout() time.Duration
+	GetRawHandshakePacketTimeout() *time.Duration
+	SetHandshakePacketTimeout(time.Duration)
+
+	ErrorPacketMatcher() func(*packet.Packet) error
+	GetRawErrorPacketMatcher() func(*packet.Packet) error
+	SetErrorPacketMatcher(func(*packet.Packet) error)
+
+	CloseOnErrorPacket() bool
+	GetRawCloseOnErrorPacket() *bool
+	SetCloseOnErrorPacket(bool)
+}
+
+// SocketOptions is the bag of options accepted by the socket constructors.
+// The zero value leaves every option unset; unset options fall back to the
+// defaults applied in Construct.
+type SocketOptions struct {
+	// host is the host the connection is made to, possibly including a port
+	// ("example.com:8080").
+	host *string
+
+	// hostname is the hostname the connection is made to.
+	hostname *string
+
+	// secure selects HTTPS/WSS schemes.
+	secure *bool
+
+	// port is the port the connection is made to.
+	port *string
+
+	// query holds parameters appended to every connection URI.
+	query url.Values
+
+	// upgrade enables probing for transport upgrades once the initial
+	// transport is open. Defaults to true.
+	upgrade *bool
+
+	// forceBase64 forces base64 encoding for polling and websocket payloads,
+	// even when binary framing is supported.
+	forceBase64 *bool
+
+	// timestampParam is the name of the cache-busting query parameter.
+	// Defaults to "t".
+	timestampParam *string
+
+	// timestampRequests adds the cache-busting parameter to every request,
+	// the handshake included.
+	timestampRequests *bool
+
+	// cacheBusterStrategy selects how the cache-busting value is generated:
+	// CacheBusterRandom (the default) uses time-ordered random strings,
+	// CacheBusterMonotonic a strictly incrementing counter, for proxies
+	// that only honor predictable, ever-growing busters. Either way the
+	// value is URL-safe.
+	cacheBusterStrategy *CacheBusterStrategy
+
+	// transports is the set of transport names the client may use.
+	// Defaults to polling, websocket and webtransport.
+	transports *types.Set[string]
+
+	// requestTimeout bounds polling requests and the websocket handshake.
+	requestTimeout *time.Duration
+
+	// pollTimeout and writeTimeout split the polling transport's deadline in
+	// two: a long-poll GET legitimately idles for the whole poll window
+	// while a POST should fail fast when the server is unresponsive. Either
+	// one, when set, overrides requestTimeout for its direction; zero keeps
+	// the shared default.
+	pollTimeout  *time.Duration
+	writeTimeout *time.Duration
+
+	// tlsClientConfig is the TLS configuration used by every transport.
+	tlsClientConfig *tls.Config
+
+	// extraHeaders are sent with every polling request and transport
+	// handshake.
+	extraHeaders http.Header
+
+	// extraHeadersFn, when set, is called for every polling request and
+	// transport dial; its result is merged over extraHeaders, with the
+	// dynamic values winning per header key. The hook for credentials that
+	// expire mid-connection (rotating Authorization tokens). It may be
+	// invoked concurrently from the poll and write goroutines and must be
+	// safe for that.
+	extraHeadersFn func() http.Header
+
+	// requestInterceptor, when set, is called with every polling HTTP
+	// request just before it is sent, after all headers are in place. It
+	// may modify the request freely - sign it, swap a token - and a
+	// non-nil error aborts the request, surfacing through the transport's
+	// error event. Like extraHeadersFn it may run concurrently from the
+	// poll and write goroutines.
+	requestInterceptor func(*http.Request) error
+
+	// path is the server endpoint path. Defaults to "/engine.io".
+	path *string
+
+	// addTrailingSlash ensures the request path ends in "/" ("/engine.io/"),
+	// matching the JavaScript client; false strips it for servers that
+	// reject the slash. A path already carrying the slash is never doubled.
+	// Defaults to true.
+	addTrailingSlash *bool
+
+	// protocolVersion selects the Engine.IO protocol revision spoken on the
+	// wire, for legacy servers that cannot be upgraded. 3 sets EIO=3 in the
+	// query, switches to the v3 parser (length-prefixed payload framing) and
+	// inverts the heartbeat: the client sends PING every pingInterval and
+	// expects the server's PONG within pingTimeout. Defaults to Protocol
+	// (4); v4 behavior is untouched unless set to 3.
+	protocolVersion *int
+
+	// parser, when set, replaces the wire parser on every encode and decode
+	// - an instrumented wrapper counting packets, a stricter validating
+	// implementation, a protocol experiment. It overrides the parser implied
+	// by protocolVersion; nil (the default) resolves to the v4 parser, or v3
+	// in EIO=3 mode.
+	parser parser.Parser
+
+	// protocols are the WebSocket subprotocols offered during the dial.
+	protocols []string
+
+	// perMessageDeflate enables WebSocket permessage-deflate when set.
+	perMessageDeflate *PerMessageDeflate
+
+	// metricsHook, when set, is invoked with a fresh TransportStats snapshot
+	// every time a transport updates its wire-level byte accounting. The hook
+	// may be called from polling and write goroutines concurrently and must
+	// be cheap.
+	metricsHook func(TransportStats)
+
+	// netDialContext, when set, replaces the default dialer of the polling
+	// HTTP client and of the WebSocket handshake, allowing custom name
+	// resolution or IP pinning. When unset the net/http and gorilla
+	// defaults apply.
+	netDialContext func(ctx context.Context, network string, addr string) (net.Conn, error)
+
+	// netDial, when set, hands the WebSocket handshake a pre-dialed (or
+	// custom-dialed) net.Conn - an SSH tunnel, an in-memory pipe for
+	// deterministic tests. It applies to the websocket transport only and
+	// wins over netDialContext there. When unset behavior is unchanged.
+	netDial func(network string, addr string) (net.Conn, error)
+
+	// closeTimeout bounds how long Close() waits for the write buffer to
+	// drain (and a pending upgrade to settle) before the close is forced.
+	// It also bounds the transports' own graceful close handshake: a
+	// polling close waiting out a stuck handshake or a websocket close
+	// frame stuck behind a wedged writer is abandoned and the connection
+	// closed hard, with "close timeout" as the reason. Zero - the default -
+	// waits forever, which can leak the socket and a goroutine when the
+	// server never drains a stuck writer.
+	closeTimeout *time.Duration
+
+	// synchronousWrites makes the websocket transport encode and write each
+	// batch inline on the calling goroutine, under the write mutex and with
+	// the write deadline applied, instead of handing it to a writer
+	// goroutine. This minimizes per-message latency at the cost of
+	// throughput: the caller blocks for the full frame write, and errors are
+	// emitted on the "error" event before the write call returns. Writes
+	// issued while the transport is paused for an upgrade fail cleanly (the
+	// batch is discarded like any write on a non-open transport).
+	synchronousWrites *bool
+
+	// transportErrorThreshold, in errors per minute, makes the socket absorb
+	// transport errors instead of closing on the first one: errors are
+	// recorded per transport and once the active transport crosses the
+	// threshold a "transportDegraded" event is emitted, on which the
+	// upgrading sockets re-probe the remaining upgrades. Zero - the default -
+	// keeps the fail-fast behavior where any transport error closes the
+	// socket.
+	transportErrorThreshold *float64
+
+	// payloadCodec, when set, is offered to the server via the "codec" query
+	// parameter and - once the handshake acknowledges it - compresses MESSAGE
+	// payloads application-side, identically on every transport. See
+	// PayloadCodec.
+	payloadCodec PayloadCodec
+
+	// payloadCodecThreshold is the payload size in bytes from which the
+	// negotiated codec actually compresses; smaller payloads are framed but
+	// sent raw. Zero - the default - compresses every payload.
+	payloadCodecThreshold *int
+
+	// writeLockTimeout bounds how long a websocket write batch may wait for
+	// the write lock, and caps the write deadline of each frame. When the
+	// lock cannot be acquired in time - a previous write is wedged - the
+	// batch fails with an error and the transport is closed instead of
+	// piling goroutines up on the lock. Zero - the default - waits forever.
+	writeLockTimeout *time.Duration
+
+	// userAgent is sent as the User-Agent header on every polling request
+	// and transport handshake, overriding any value from ExtraHeaders.
+	// Defaults to "engine.io-client-go/<version>".
+	userAgent *string
+
+	// onHandshakeResponse, when set, is called once with the response
+	// headers of the transport open that established the connection - the
+	// first GET for polling, the dial response for websocket and
+	// webtransport - before the "open" event fires. Useful for reading
+	// load-balancer sticky cookies or custom auth tokens without snooping
+	// the cookie jar.
+	onHandshakeResponse func(http.Header)
+
+	// repanicWriteCallbacks restores the fail-fast behavior for panics in
+	// the done callbacks passed to Send/Write. By default such a panic is
+	// recovered and surfaced as an "error" event carrying the stack, keeping
+	// the drain pipeline alive; with this option set the panic propagates on
+	// the flushing goroutine instead.
+	repanicWriteCallbacks *bool
+
+	// handshakeBody, when set, turns the very first polling request into a
+	// POST carrying this body, for gateways that demand a credential
+	// exchange (a signed token blob, say) before letting the handshake
+	// through. The response is still parsed as a standard handshake. It has
+	// no effect on transports that handshake over an HTTP upgrade, such as
+	// websocket dialed directly.
+	handshakeBody []byte
+
+	// handshakeContentType is the Content-Type header sent along with
+	// HandshakeBody. Defaults to "application/octet-stream".
+	handshakeContentType *string
+
+	// handshakeBodyProvider, when set, supplies an authentication blob (and
+	// its content type) for every handshake attempt, keeping credentials
+	// out of URLs, headers and logs. It takes precedence over
+	// HandshakeBody. On a polling handshake the blob rides the initial
+	// POST; on a websocket-first connection it goes out as the very first
+	// MESSAGE packet, before "open" reaches the application. An empty
+	// content type falls back to HandshakeContentType. Failures surface as
+	// *HandshakeError.
+	handshakeBodyProvider func() (io.Reader, string)
+
+	// requireBinary rejects any base64 downgrade of binary payloads: a
+	// transport that can only carry binary as base64 (polling does, always)
+	// fails the write with an error instead of eating the 33% encoding
+	// overhead silently. Mutually exclusive with ForceBase64 - setting both
+	// fails the transport on open.
+	requireBinary *bool
+
+	// socketReadBuffer, in bytes, sets SO_RCVBUF on the TCP connections
+	// dialed by the polling and websocket transports, for long fat networks
+	// where the kernel defaults starve throughput. The OS may clamp or
+	// round the value (Linux doubles it and enforces rmem_max); failures to
+	// apply it are logged, not fatal. It does not affect webtransport,
+	// which runs over UDP. Zero - the default - leaves the kernel default.
+	socketReadBuffer *int
+
+	// socketWriteBuffer is the SO_SNDBUF counterpart of SocketReadBuffer,
+	// with the same caveats (Linux doubles it and enforces wmem_max).
+	socketWriteBuffer *int
+
+	// maxBufferedPackets caps how many packets the socket's write buffer may
+	// hold before sends apply backpressure (see BlockOnBufferFull). A slow
+	// or upgrading transport otherwise lets the buffer grow without bound.
+	// Zero - the default - leaves it unbounded.
+	maxBufferedPackets *int
+
+	// maxBufferedBytes caps the payload bytes the write buffer may hold,
+	// the byte-level counterpart of MaxBufferedPackets. A single packet
+	// larger than the cap is still accepted into an empty buffer. Zero -
+	// the default - leaves it unbounded.
+	maxBufferedBytes *int64
+
+	// blockOnBufferFull selects what a send does when a buffer cap is hit:
+	// true blocks the caller until the buffer drains below the cap (or the
+	// socket's context ends), false - the default - rejects the packet with
+	// ErrBufferFull.
+	blockOnBufferFull *bool
+
+	// maxPayload caps the encoded size of a single polling POST: the flush
+	// splits the write buffer into multiple requests when needed, keeping
+	// strict servers from answering 413. When unset the maxPayload
+	// advertised in the server's handshake applies, when present.
+	maxPayload *int
+
+	// recorder, when set, captures every state transition, packet, request
+	// and event emission of the socket as timestamped NDJSON, for replayable
+	// bug reports; see Recorder.
+	recorder *Recorder
+
+	// allowedUpgrades, when set, is an allowlist of transport transitions the
+	// upgrade probes may attempt, keyed by the current transport's name. A
+	// probe from a transport without an entry is skipped - so a socket that
+	// starts on websocket never probes webtransport unless the map says so.
+	// Unset - the default - permits every server-offered upgrade.
+	allowedUpgrades map[string][]string
+
+	// flushInterval, when positive, coalesces writes: a queued packet no
+	// longer flushes right away but waits out this window so small trickles
+	// share a transport write (one POST, one frame batch). Zero - the
+	// default - keeps the immediate flush.
+	flushInterval *time.Duration
+
+	// flushMaxPackets cuts the FlushInterval window short: once this many
+	// packets have accumulated the batch goes out immediately, so bursts do
+	// not pay the coalescing latency. Zero leaves only the time trigger.
+	flushMaxPackets *int
+
+	// flushMaxBytes is the byte-level counterpart of FlushMaxPackets: the
+	// batch goes out as soon as its buffered payload reaches this size.
+	flushMaxBytes *int64
+
+	// upgradeProbeDelay is the head start WebTransport gets during upgrade
+	// probing: other upgrade probes wait this long so the fastest transport
+	// can win first. Zero starts every probe immediately. Unset - the
+	// default - keeps the 200ms of the reference client.
+	upgradeProbeDelay *time.Duration
+
+	// pingTimeoutGrace tolerates heartbeats running up to this much past
+	// their deadline before the connection is declared dead - machines waking
+	// from sleep routinely blow the deadline without the server being gone.
+	// Checks landing inside the window emit "ping_late". Zero - the default -
+	// keeps the strict deadline.
+	pingTimeoutGrace *time.Duration
+
+	// tokenViaSubprotocol, when set, smuggles an authorization token into
+	// the websocket dial as an extra Sec-WebSocket-Protocol entry, for
+	// gateways that strip unknown headers but pass the subprotocol list
+	// through. See SetTokenViaSubprotocol and SubprotocolToken.
+	tokenViaSubprotocol *SubprotocolToken
+
+	// reconnection makes the socket reopen itself after an unexpected close
+	// (a user Close or context cancellation stays final), with exponential
+	// backoff between attempts. Each wait is announced by a
+	// "reconnectScheduled" event carrying the attempt number and the
+	// computed delay. Off by default, matching the reference client where
+	// reconnection lives a layer up.
+	reconnection *bool
+
+	// reconnectionDelay is the backoff base: attempt n waits roughly
+	// delay*2^(n-1), capped by ReconnectionDelayMax. Defaults to one second.
+	reconnectionDelay *time.Duration
+
+	// reconnectionDelayMax caps the backoff. Defaults to five seconds.
+	reconnectionDelayMax *time.Duration
+
+	// randomizationFactor spreads the reconnect waits of a disconnected
+	// fleet: each computed delay is jittered by up to this fraction in
+	// either direction. Defaults to 0.5; zero disables the jitter.
+	randomizationFactor *float64
+
+	// maxReconnectionAttempts caps the consecutive reconnect attempts before
+	// the socket gives up, emits "reconnect_failed" and stays closed. The
+	// counter resets on every successful open, so only unbroken failure
+	// streaks count; the backoff strategy is unaffected up to the cap. Zero
+	// (the default) retries forever.
+	maxReconnectionAttempts *int
+
+	// maxConcurrentWrites caps the writer goroutines a flood of Sends may
+	// pile onto the websocket transport (each batch normally spawns one,
+	// queuing on the write lock). At the cap the policy follows
+	// BlockOnBufferFull: block the caller until a slot frees, or - the
+	// default - fail the batch. Zero leaves the count unbounded.
+	maxConcurrentWrites *int
+
+	// maxPacketsPerBatch bounds how many packets of one polling payload are
+	// handled back to back: after that many the read goroutine yields before
+	// continuing, so a huge payload cannot monopolize it. All packets are
+	// still delivered in order and the poll completes only after the last
+	// one. Zero (the default) handles the whole payload without yielding.
+	maxPacketsPerBatch *int
+
+	// readErrorPolicy, when set, classifies websocket read errors:
+	// returning true marks the error recoverable and the read loop logs it
+	// and keeps reading instead of tearing the connection down. Close
+	// errors are never offered to the policy. Unset, every read error is
+	// fatal (the historical behavior).
+	readErrorPolicy func(error) bool
+
+	// maxConsecutiveReadErrors caps how many recoverable read errors in a
+	// row the read loop will ride out before giving up; a successful read
+	// resets the count. Only consulted when readErrorPolicy is set.
+	// Defaults to 3.
+	maxConsecutiveReadErrors *int
+
+	// openTimeout bounds the time a socket may spend in the opening state.
+	// When the Engine.IO handshake has not completed by the deadline the
+	// transport is closed, an "error" event with a *TimeoutError fires and
+	// the socket transitions to closed. Zero (the default) waits forever.
+	openTimeout *time.Duration
+
+	// probeTimeout bounds how long an upgrade probe waits for its PONG. A
+	// proxy silently dropping the upgrade would otherwise leave the candidate
+	// transport and its listeners lingering for the life of the connection.
+	// Defaults to 10 seconds when unset; zero or negative disables the bound.
+	probeTimeout *time.Duration
+
+	// pingTimeoutJitter stretches the heartbeat watchdog deadline by a random
+	// fraction of itself, up to the given factor - keep it at a few percent
+	// (0.05 = up to 5% later). It desynchronizes the timeout checks of client
+	// fleets sharing one pingInterval so a brief server hiccup does not
+	// trigger a synchronized reconnection storm. Client-side watchdog only;
+	// the protocol's ping/pong timings are unaffected. Defaults to 0.
+	pingTimeoutJitter *float64
+
+	// downgradeAfterPingTimeouts, when positive, marks a non-polling
+	// transport as problematic once it has tripped that many ping timeouts -
+	// the signature of a middlebox dropping idle connections that polling
+	// sails through. A "transportDowngrade" event fires and subsequent
+	// reconnects prefer polling over the flagged transport, probes included.
+	// Zero (the default) disables the accounting.
+	downgradeAfterPingTimeouts *int
+
+	// rememberUpgrade skips the polling bootstrap on subsequent connections
+	// when the previous one successfully upgraded to websocket (see
+	// PriorWebsocketSuccess), starting directly on the websocket transport.
+	// A failed direct attempt falls back to the normal ordering. Defaults to
+	// false.
+	rememberUpgrade *bool
+
+	// transportOptions holds per-transport overrides, keyed by transport name
+	// ("polling", "websocket", "webtransport"). CreateTransport merges the
+	// matching entry on top of the global options, so an override's set
+	// fields - different ExtraHeaders for polling than for websocket, a
+	// different Path - win for that transport only.
+	transportOptions map[string]SocketOptionsInterface
+
+	// selectInitialTransport, when set, is consulted right before the first
+	// transport opens, with the configured transport names; whatever it
+	// returns is used when it is in that set, generalizing "polling first"
+	// into app-controlled logic. An empty or unknown return keeps the
+	// default choice (including a RememberUpgrade shortcut).
+	selectInitialTransport func(available []string) string
+
+	// webTransportRouting, when set, is consulted for every packet the
+	// webtransport transport writes: returning true routes the packet onto
+	// the unreliable datagram channel instead of the ordered stream (bulk
+	// telemetry, say, while control traffic stays reliable). A packet whose
+	// datagram send fails - channel not negotiated, frame too large - falls
+	// back to the stream, so nothing is silently dropped. Unset, everything
+	// travels on the stream.
+	webTransportRouting func(*packet.Packet) bool
+
+	// handshakePacketTimeout caps the handshake phase alone: the wait
+	// between the transport opening and the server's OPEN packet. OpenTimeout
+	// bounds the whole attempt; this catches a server that accepted the
+	// transport but never completes the protocol handshake. Zero (the
+	// default) leaves the phase unbounded.
+	handshakePacketTimeout *time.Duration
+
+	// errorPacketMatcher, when set, inspects every incoming packet; a
+	// non-nil return marks the packet as a server-side error, emitted as an
+	// "error" event (wrapped in an *Error with the packet as context)
+	// instead of surfacing as a message. Engine.IO is transport-level, but
+	// some servers flag application errors in a specially-formatted MESSAGE
+	// before closing; this spares applications parsing every packet.
+	errorPacketMatcher func(*packet.Packet) error
+
+	// closeOnErrorPacket additionally closes the socket when
+	// errorPacketMatcher flags a packet, making matched server errors
+	// connection-fatal. Defaults to false.
+	closeOnErrorPacket *bool
+}
+
+// defaultSocketOptions holds the package-wide option base installed by
+// SetDefaultSocketOptions, guarded for concurrent installs and reads.
+var (
+	defaultSocketOptionsMu sync.RWMutex
+	defaultSocketOptions   SocketOptionsInterface
+)
+
+// SetDefaultSocketOptions installs opts as the base every DefaultSocketOptions
+// call starts from - the place for the TLS config and auth headers a fleet of
+// sockets shares, set once instead of per socket. nil clears the base. The
+// values are read-copied at DefaultSocketOptions time, so later SetDefault
+// calls do not affect options already handed out; mutating opts itself after
+// installing it races with those copies.
+func SetDefaultSocketOptions(opts SocketOptionsInterface) {
+	defaultSocketOptionsMu.Lock()
+	defaultSocketOptions = opts
+	defaultSocketOptionsMu.Unlock()
+}
+
+// DefaultSocketOptions returns a fresh *SocketOptions seeded from the base
+// installed via SetDefaultSocketOptions (empty when none is installed), ready
+// for per-socket overrides on top. Note that Assign copies option values, not
+// what they point at: a shared header map or TLS config is still shared.
+func DefaultSocketOptions() *SocketOptions {
+	defaultSocketOptionsMu.RLock()
+	defer defaultSocketOptionsMu.RUnlock()
+
+	opts := &SocketOptions{}
+	opts.Assign(defaultSocketOptions)
+	return opts
+}
+
+// Assign copies every option set on data over the receiver, leaving options
+// absent from data untouched.
+func (s *SocketOptions) Assign(data SocketOptionsInterface) SocketOptionsInterface {
+	if data == nil {
+		return s
+	}
+
+	if data.GetRawHost() != nil {
+		s.SetHost(data.Host())
+	}
+	if data.GetRawHostname() != nil {
+		s.SetHostname(data.Hostname())
+	}
+	if data.GetRawSecure() != nil {
+		s.SetSecure(data.Secure())
+	}
+	if data.GetRawPort() != nil {
+		s.SetPort(data.Port())
+	}
+	if data.GetRawQuery() != nil {
+		s.SetQuery(data.Query())
+	}
+	if data.GetRawUpgrade() != nil {
+		s.SetUpgrade(data.Upgrade())
+	}
+	if data.GetRawForceBase64() != nil {
+		s.SetForceBase64(data.ForceBase64())
+	}
+	if data.GetRawTimestampParam() != nil {
+		s.SetTimestampParam(data.TimestampParam())
+	}
+	if data.GetRawTimestampRequests() != nil {
+		s.SetTimestampRequests(data.TimestampRequests())
+	}
+	if data.GetRawCacheBusterStrategy() != nil {
+		s.SetCacheBusterStrategy(data.CacheBusterStrategy())
+	}
+	if data.GetRawTransports() != nil {
+		s.SetTransports(data.Transports())
+	}
+	if data.GetRawRequestTimeout() != nil {
+		s.SetRequestTimeout(data.RequestTimeout())
+	}
+
+	if data.GetRawPollTimeout() != nil {
+		s.SetPollTimeout(data.PollTimeout())
+	}
+
+	if data.GetRawWriteTimeout() != nil {
+		s.SetWriteTimeout(data.WriteTimeout())
+	}
+	if data.GetRawTLSClientConfig() != nil {
+		s.SetTLSClientConfig(data.TLSClientConfig())
+	}
+	if data.GetRawExtraHeaders() != nil {
+		s.SetExtraHeaders(data.ExtraHeaders())
+	}
+	if data.GetRawExtraHeadersFn() != nil {
+		s.SetExtraHeadersFn(data.ExtraHeadersFn())
+	}
+	if data.GetRawRequestInterceptor() != nil {
+		s.SetRequestInterceptor(data.RequestInterceptor())
+	}
+	if data.GetRawPath() != nil {
+		s.SetPath(data.Path())
+	}
+	if data.GetRawAddTrailingSlash() != nil {
+		s.SetAddTrailingSlash(data.AddTrailingSlash())
+	}
+	if data.GetRawProtocolVersion() != nil {
+		s.SetProtocolVersion(data.ProtocolVersion())
+	}
+
+	if data.GetRawParser() != nil {
+		s.SetParser(data.Parser())
+	}
+	if data.GetRawProtocols() != nil {
+		s.SetProtocols(data.Protocols())
+	}
+	if data.GetRawPerMessageDeflate() != nil {
+		s.SetPerMessageDeflate(data.PerMessageDeflate())
+	}
+	if data.GetRawMetricsHook() != nil {
+		s.SetMetricsHook(data.MetricsHook())
+	}
+	if data.GetRawNetDialContext() != nil {
+		s.SetNetDialContext(data.NetDialContext())
+	}
+	if data.GetRawNetDial() != nil {
+		s.SetNetDial(data.NetDial())
+	}
+	if data.GetRawCloseTimeout() != nil {
+		s.SetCloseTimeout(data.CloseTimeout())
+	}
+	if data.GetRawSynchronousWrites() != nil {
+		s.SetSynchronousWrites(data.SynchronousWrites())
+	}
+	if data.GetRawTransportErrorThreshold() != nil {
+		s.SetTransportErrorThreshold(data.TransportErrorThreshold())
+	}
+	if data.GetRawPayloadCodec() != nil {
+		s.SetPayloadCodec(data.PayloadCodec())
+	}
+	if data.GetRawPayloadCodecThreshold() != nil {
+		s.SetPayloadCodecThreshold(data.PayloadCodecThreshold())
+	}
+	if data.GetRawWriteLockTimeout() != nil {
+		s.SetWriteLockTimeout(data.WriteLockTimeout())
+	}
+	if data.GetRawUserAgent() != nil {
+		s.SetUserAgent(data.UserAgent())
+	}
+	if data.GetRawOnHandshakeResponse() != nil {
+		s.SetOnHandshakeResponse(data.OnHandshakeResponse())
+	}
+	if data.GetRawRepanicWriteCallbacks() != nil {
+		s.SetRepanicWriteCallbacks(data.RepanicWriteCallbacks())
+	}
+	if data.GetRawHandshakeBody() != nil {
+		s.SetHandshakeBody(data.HandshakeBody())
+	}
+	if data.GetRawHandshakeContentType() != nil {
+		s.SetHandshakeContentType(data.HandshakeContentType())
+	}
+	if data.GetRawHandshakeBodyProvider() != nil {
+		s.SetHandshakeBodyProvider(data.HandshakeBodyProvider())
+	}
+	if data.GetRawRequireBinary() != nil {
+		s.SetRequireBinary(data.RequireBinary())
+	}
+	if data.GetRawSocketReadBuffer() != nil {
+		s.SetSocketReadBuffer(data.SocketReadBuffer())
+	}
+	if data.GetRawSocketWriteBuffer() != nil {
+		s.SetSocketWriteBuffer(data.SocketWriteBuffer())
+	}
+	if data.GetRawMaxBufferedPackets() != nil {
+		s.SetMaxBufferedPackets(data.MaxBufferedPackets())
+	}
+	if data.GetRawMaxBufferedBytes() != nil {
+		s.SetMaxBufferedBytes(data.MaxBufferedBytes())
+	}
+	if data.GetRawBlockOnBufferFull() != nil {
+		s.SetBlockOnBufferFull(data.BlockOnBufferFull())
+	}
+	if data.GetRawMaxPayload() != nil {
+		s.SetMaxPayload(data.MaxPayload())
+	}
+	if data.GetRawRecorder() != nil {
+		s.SetRecorder(data.Recorder())
+	}
+	if data.GetRawAllowedUpgrades() != nil {
+		s.SetAllowedUpgrades(data.AllowedUpgrades())
+	}
+	if data.GetRawFlushInterval() != nil {
+		s.SetFlushInterval(data.FlushInterval())
+	}
+	if data.GetRawFlushMaxPackets() != nil {
+		s.SetFlushMaxPackets(data.FlushMaxPackets())
+	}
+	if data.GetRawFlushMaxBytes() != nil {
+		s.SetFlushMaxBytes(data.FlushMaxBytes())
+	}
+	if data.GetRawUpgradeProbeDelay() != nil {
+		s.SetUpgradeProbeDelay(data.UpgradeProbeDelay())
+	}
+	if data.GetRawPingTimeoutGrace() != nil {
+		s.SetPingTimeoutGrace(data.PingTimeoutGrace())
+	}
+	if token := data.GetRawTokenViaSubprotocol(); token != nil {
+		s.SetTokenViaSubprotocol(token.Prefix, token.Token)
+	}
+	if data.GetRawReconnection() != nil {
+		s.SetReconnection(data.Reconnection())
+	}
+	if data.GetRawReconnectionDelay() != nil {
+		s.SetReconnectionDelay(data.ReconnectionDelay())
+	}
+	if data.GetRawReconnectionDelayMax() != nil {
+		s.SetReconnectionDelayMax(data.ReconnectionDelayMax())
+	}
+	if data.GetRawRandomizationFactor() != nil {
+		s.SetRandomizationFactor(data.RandomizationFactor())
+	}
+
+	if data.GetRawMaxReconnectionAttempts() != nil {
+		s.SetMaxReconnectionAttempts(data.MaxReconnectionAttempts())
+	}
+	if data.GetRawMaxConcurrentWrites() != nil {
+		s.SetMaxConcurrentWrites(data.MaxConcurrentWrites())
+	}
+	if data.GetRawMaxPacketsPerBatch() != nil {
+		s.SetMaxPacketsPerBatch(data.MaxPacketsPerBatch())
+	}
+	if data.GetRawReadErrorPolicy() != nil {
+		s.SetReadErrorPolicy(data.ReadErrorPolicy())
+	}
+	if data.GetRawMaxConsecutiveReadErrors() != nil {
+		s.SetMaxConsecutiveReadErrors(data.MaxConsecutiveReadErrors())
+	}
+	if data.GetRawOpenTimeout() != nil {
+		s.SetOpenTimeout(data.OpenTimeout())
+	}
+	if data.GetRawProbeTimeout() != nil {
+		s.SetProbeTimeout(data.ProbeTimeout())
+	}
+	if data.GetRawPingTimeoutJitter() != nil {
+		s.SetPingTimeoutJitter(data.PingTimeoutJitter())
+	}
+	if data.GetRawDowngradeAfterPingTimeouts() != nil {
+		s.SetDowngradeAfterPingTimeouts(data.DowngradeAfterPingTimeouts())
+	}
+	if data.GetRawRememberUpgrade() != nil {
+		s.SetRememberUpgrade(data.RememberUpgrade())
+	}
+	if data.GetRawTransportOptions() != nil {
+		s.SetTransportOptions(data.TransportOptions())
+	}
+	if data.GetRawSelectInitialTransport() != nil {
+		s.SetSelectInitialTransport(data.SelectInitialTransport())
+	}
+	if data.GetRawWebTransportRouting() != nil {
+		s.SetWebTransportRouting(data.WebTransportRouting())
+	}
+	if data.GetRawHandshakePacketTimeout() != nil {
+		s.SetHandshakePacketTimeout(data.HandshakePacketTimeout())
+	}
+	if data.GetRawErrorPacketMatcher() != nil {
+		s.SetErrorPacketMatcher(data.ErrorPacketMatcher())
+	}
+	if data.GetRawCloseOnErrorPacket() != nil {
+		s.SetCloseOnErrorPacket(data.CloseOnErrorPacket())
+	}
+
+	return s
+}
+
+func (s *SocketOptions) Host() string {
+	if s.host == nil {
+		return ""
+	}
+	return *s.host
+}
+func (s *SocketOptions) GetRawHost() *string { return s.host }
+func (s *SocketOptions) SetHost(host string) { s.host = &host }
+
+func (s *SocketOptions) Hostname() string {
+	if s.hostname == nil {
+		return ""
+	}
+	return *s.hostname
+}
+func (s *SocketOptions) GetRawHostname() *string     { return s.hostname }
+func (s *SocketOptions) SetHostname(hostname string) { s.hostname = &hostname }
+
+func (s *SocketOptions) Secure() bool {
+	if s.secure == nil {
+		return false
+	}
+	return *s.secure
+}
+func (s *SocketOptions) GetRawSecure() *bool { return s.secure }
+func (s *SocketOptions) SetSecure(secure bool) {
+	s.secure = &secure
+}
+
+func (s *SocketOptions) Port() string {
+	if s.port == nil {
+		return ""
+	}
+	return *s.port
+}
+func (s *SocketOptions) GetRawPort() *string { return s.port }
+func (s *SocketOptions) SetPort(port string) { s.port = &port }
+
+func (s *SocketOptions) Query() url.Values         { return s.query }
+func (s *SocketOptions) GetRawQuery() url.Values   { return s.query }
+func (s *SocketOptions) SetQuery(query url.Values) { s.query = query }
+
+func (s *SocketOptions) Upgrade() bool {
+	if s.upgrade == nil {
+		return false
+	}
+	return *s.upgrade
+}
+func (s *SocketOptions) GetRawUpgrade() *bool    { return s.upgrade }
+func (s *SocketOptions) SetUpgrade(upgrade bool) { s.upgrade = &upgrade }
+
+func (s *SocketOptions) ForceBase64() bool {
+	if s.forceBase64 == nil {
+		return false
+	}
+	return *s.forceBase64
+}
+func (s *SocketOptions) GetRawForceBase64() *bool        { return s.forceBase64 }
+func (s *SocketOptions) SetForceBase64(forceBase64 bool) { s.forceBase64 = &forceBase64 }
+
+func (s *SocketOptions) TimestampParam() string {
+	if s.timestampParam == nil {
+		return ""
+	}
+	return *s.timestampParam
+}
+func (s *SocketOptions) GetRawTimestampParam() *string           { return s.timestampParam }
+func (s *SocketOptions) SetTimestampParam(timestampParam string) { s.timestampParam = &timestampParam }
+
+func (s *SocketOptions) TimestampRequests() bool {
+	if s.timestampRequests == nil {
+		return false
+	}
+	return *s.timestampRequests
+}
+func (s *SocketOptions) GetRawTimestampRequests() *bool { return s.timestampRequests }
+func (s *SocketOptions) SetTimestampRequests(timestampRequests bool) {
+	s.timestampRequests = &timestampRequests
+}
+
+func (s *SocketOptions) CacheBusterStrategy() CacheBusterStrategy {
+	if s.cacheBusterStrategy == nil {
+		return CacheBusterRandom
+	}
+	return *s.cacheBusterStrategy
+}
+func (s *SocketOptions) GetRawCacheBusterStrategy() *CacheBusterStrategy {
+	return s.cacheBusterStrategy
+}
+func (s *SocketOptions) SetCacheBusterStrategy(cacheBusterStrategy CacheBusterStrategy) {
+	s.cacheBusterStrategy = &cacheBusterStrategy
+}
+
+func (s *SocketOptions) Transports() *types.Set[string]              { return s.transports }
+func (s *SocketOptions) GetRawTransports() *types.Set[string]        { return s.transports }
+func (s *SocketOptions) SetTransports(transports *types.Set[string]) { s.transports = transports }
+
+func (s *SocketOptions) RequestTimeout() time.Duration {
+	if s.requestTimeout == nil {
+		return 0
+	}
+	return *s.requestTimeout
+}
+func (s *SocketOptions) GetRawRequestTimeout() *time.Duration { return s.requestTimeout }
+func (s *SocketOptions) SetRequestTimeout(requestTimeout time.Duration) {
+	s.requestTimeout = &requestTimeout
+}
+
+func (s *SocketOptions) PollTimeout() time.Duration {
+	if s.pollTimeout == nil {
+		return 0
+	}
+	return *s.pollTimeout
+}
+func (s *SocketOptions) GetRawPollTimeout() *time.Duration { return s.pollTimeout }
+func (s *SocketOptions) SetPollTimeout(pollTimeout time.Duration) {
+	s.pollTimeout = &pollTimeout
+}
+
+func (s *SocketOptions) WriteTimeout() time.Duration {
+	if s.writeTimeout == nil {
+		return 0
+	}
+	return *s.writeTimeout
+}
+func (s *SocketOptions) GetRawWriteTimeout() *time.Duration { return s.writeTimeout }
+func (s *SocketOptions) SetWriteTimeout(writeTimeout time.Duration) {
+	s.writeTimeout = &writeTimeout
+}
+
+func (s *SocketOptions) TLSClientConfig() *tls.Config       { return s.tlsClientConfig }
+func (s *SocketOptions) GetRawTLSClientConfig() *tls.Config { return s.tlsClientConfig }
+func (s *SocketOptions) SetTLSClientConfig(tlsClientConfig *tls.Config) {
+	s.tlsClientConfig = tlsClientConfig
+}
+
+func (s *SocketOptions) ExtraHeaders() http.Header       { return s.extraHeaders }
+func (s *SocketOptions) GetRawExtraHeaders() http.Header { return s.extraHeaders }
+func (s *SocketOptions) SetExtraHeaders(extraHeaders http.Header) {
+	s.extraHeaders = extraHeaders
+}
+
+func (s *SocketOptions) ExtraHeadersFn() func() http.Header       { return s.extraHeadersFn }
+func (s *SocketOptions) GetRawExtraHeadersFn() func() http.Header { return s.extraHeadersFn }
+func (s *SocketOptions) SetExtraHeadersFn(extraHeadersFn func() http.Header) {
+	s.extraHeadersFn = extraHeadersFn
+}
+
+func (s *SocketOptions) RequestInterceptor() func(*http.Request) error {
+	return s.requestInterceptor
+}
+func (s *SocketOptions) GetRawRequestInterceptor() func(*http.Request) error {
+	return s.requestInterceptor
+}
+func (s *SocketOptions) SetRequestInterceptor(requestInterceptor func(*http.Request) error) {
+	s.requestInterceptor = requestInterceptor
+}
+
+func (s *SocketOptions) Path() string {
+	if s.path == nil {
+		return ""
+	}
+	return *s.path
+}
+func (s *SocketOptions) GetRawPath() *string { return s.path }
+func (s *SocketOptions) SetPath(path string) { s.path = &path }
+
+func (s *SocketOptions) AddTrailingSlash() bool {
+	if s.addTrailingSlash == nil {
+		return true
+	}
+	return *s.addTrailingSlash
+}
+func (s *SocketOptions) GetRawAddTrailingSlash() *bool { return s.addTrailingSlash }
+func (s *SocketOptions) SetAddTrailingSlash(addTrailingSlash bool) {
+	s.addTrailingSlash = &addTrailingSlash
+}
+
+func (s *SocketOptions) ProtocolVersion() int {
+	if s.protocolVersion == nil {
+		return Protocol
+	}
+	return *s.protocolVersion
+}
+func (s *SocketOptions) GetRawProtocolVersion() *int { return s.protocolVersion }
+func (s *SocketOptions) SetProtocolVersion(protocolVersion int) {
+	s.protocolVersion = &protocolVersion
+}
+
+func (s *SocketOptions) Parser() parser.Parser       { return s.parser }
+func (s *SocketOptions) GetRawParser() parser.Parser { return s.parser }
+func (s *SocketOptions) SetParser(parser parser.Parser) {
+	s.parser = parser
+}
+
+func (s *SocketOptions) Protocols() []string       { return s.protocols }
+func (s *SocketOptions) GetRawProtocols() []string { return s.protocols }
+func (s *SocketOptions) SetProtocols(protocols []string) {
+	s.protocols = protocols
+}
+
+func (s *SocketOptions) PerMessageDeflate() *PerMessageDeflate       { return s.perMessageDeflate }
+func (s *SocketOptions) GetRawPerMessageDeflate() *PerMessageDeflate { return s.perMessageDeflate }
+func (s *SocketOptions) SetPerMessageDeflate(perMessageDeflate *PerMessageDeflate) {
+	s.perMessageDeflate = perMessageDeflate
+}
+
+func (s *SocketOptions) MetricsHook() func(TransportStats)       { return s.metricsHook }
+func (s *SocketOptions) GetRawMetricsHook() func(TransportStats) { return s.metricsHook }
+func (s *SocketOptions) SetMetricsHook(metricsHook func(TransportStats)) {
+	s.metricsHook = metricsHook
+}
+
+func (s *SocketOptions) NetDialContext() func(ctx context.Context, network string, addr string) (net.Conn, error) {
+	return s.netDialContext
+}
+func (s *SocketOptions) GetRawNetDialContext() func(ctx context.Context, network string, addr string) (net.Conn, error) {
+	return s.netDialContext
+}
+func (s *SocketOptions) SetNetDialContext(netDialContext func(ctx context.Context, network string, addr string) (net.Conn, error)) {
+	s.netDialContext = netDialContext
+}
+
+func (s *SocketOptions) NetDial() func(network string, addr string) (net.Conn, error) {
+	return s.netDial
+}
+func (s *SocketOptions) GetRawNetDial() func(network string, addr string) (net.Conn, error) {
+	return s.netDial
+}
+func (s *SocketOptions) SetNetDial(netDial func(network string, addr string) (net.Conn, error)) {
+	s.netDial = netDial
+}
+
+func (s *SocketOptions) CloseTimeout() time.Duration {
+	if s.closeTimeout == nil {
+		return 0
+	}
+	return *s.closeTimeout
+}
+func (s *SocketOptions) GetRawCloseTimeout() *time.Duration { return s.closeTimeout }
+func (s *SocketOptions) SetCloseTimeout(closeTimeout time.Duration) {
+	s.closeTimeout = &closeTimeout
+}
+
+func (s *SocketOptions) SynchronousWrites() bool {
+	if s.synchronousWrites == nil {
+		return false
+	}
+	return *s.synchronousWrites
+}
+func (s *SocketOptions) GetRawSynchronousWrites() *bool { return s.synchronousWrites }
+func (s *SocketOptions) SetSynchronousWrites(synchronousWrites bool) {
+	s.synchronousWrites = &synchronousWrites
+}
+
+func (s *SocketOptions) TransportErrorThreshold() float64 {
+	if s.transportErrorThreshold == nil {
+		return 0
+	}
+	return *s.transportErrorThreshold
+}
+func (s *SocketOptions) GetRawTransportErrorThreshold() *float64 { return s.transportErrorThreshold }
+func (s *SocketOptions) SetTransportErrorThreshold(transportErrorThreshold float64) {
+	s.transportErrorThreshold = &transportErrorThreshold
+}
+
+func (s *SocketOptions) PayloadCodec() PayloadCodec       { return s.payloadCodec }
+func (s *SocketOptions) GetRawPayloadCodec() PayloadCodec { return s.payloadCodec }
+func (s *SocketOptions) SetPayloadCodec(payloadCodec PayloadCodec) {
+	s.payloadCodec = payloadCodec
+}
+
+func (s *SocketOptions) PayloadCodecThreshold() int {
+	if s.payloadCodecThreshold == nil {
+		return 0
+	}
+	return *s.payloadCodecThreshold
+}
+func (s *SocketOptions) GetRawPayloadCodecThreshold() *int { return s.payloadCodecThreshold }
+func (s *SocketOptions) SetPayloadCodecThreshold(payloadCodecThreshold int) {
+	s.payloadCodecThreshold = &payloadCodecThreshold
+}
+
+func (s *SocketOptions) WriteLockTimeout() time.Duration {
+	if s.writeLockTimeout == nil {
+		return 0
+	}
+	return *s.writeLockTimeout
+}
+func (s *SocketOptions) GetRawWriteLockTimeout() *time.Duration { return s.writeLockTimeout }
+func (s *SocketOptions) SetWriteLockTimeout(writeLockTimeout time.Duration) {
+	s.writeLockTimeout = &writeLockTimeout
+}
+
+func (s *SocketOptions) UserAgent() string {
+	if s.userAgent == nil {
+		return ""
+	}
+	return *s.userAgent
+}
+func (s *SocketOptions) GetRawUserAgent() *string      { return s.userAgent }
+func (s *SocketOptions) SetUserAgent(userAgent string) { s.userAgent = &userAgent }
+
+func (s *SocketOptions) OnHandshakeResponse() func(http.Header)       { return s.onHandshakeResponse }
+func (s *SocketOptions) GetRawOnHandshakeResponse() func(http.Header) { return s.onHandshakeResponse }
+func (s *SocketOptions) SetOnHandshakeResponse(onHandshakeResponse func(http.Header)) {
+	s.onHandshakeResponse = onHandshakeResponse
+}
+
+func (s *SocketOptions) RepanicWriteCallbacks() bool {
+	if s.repanicWriteCallbacks == nil {
+		return false
+	}
+	return *s.repanicWriteCallbacks
+}
+func (s *SocketOptions) GetRawRepanicWriteCallbacks() *bool { return s.repanicWriteCallbacks }
+func (s *SocketOptions) SetRepanicWriteCallbacks(repanicWriteCallbacks bool) {
+	s.repanicWriteCallbacks = &repanicWriteCallbacks
+}
+
+func (s *SocketOptions) HandshakeBody() []byte       { return s.handshakeBody }
+func (s *SocketOptions) GetRawHandshakeBody() []byte { return s.handshakeBody }
+func (s *SocketOptions) SetHandshakeBody(handshakeBody []byte) {
+	s.handshakeBody = handshakeBody
+}
+
+func (s *SocketOptions) HandshakeContentType() string {
+	if s.handshakeContentType == nil {
+		return "application/octet-stream"
+	}
+	return *s.handshakeContentType
+}
+func (s *SocketOptions) GetRawHandshakeContentType() *string { return s.handshakeContentType }
+func (s *SocketOptions) SetHandshakeContentType(handshakeContentType string) {
+	s.handshakeContentType = &handshakeContentType
+}
+
+func (s *SocketOptions) HandshakeBodyProvider() func() (io.Reader, string) {
+	return s.handshakeBodyProvider
+}
+func (s *SocketOptions) GetRawHandshakeBodyProvider() func() (io.Reader, string) {
+	return s.handshakeBodyProvider
+}
+func (s *SocketOptions) SetHandshakeBodyProvider(handshakeBodyProvider func() (io.Reader, string)) {
+	s.handshakeBodyProvider = handshakeBodyProvider
+}
+
+func (s *SocketOptions) RequireBinary() bool {
+	if s.requireBinary == nil {
+		return false
+	}
+	return *s.requireBinary
+}
+func (s *SocketOptions) GetRawRequireBinary() *bool          { return s.requireBinary }
+func (s *SocketOptions) SetRequireBinary(requireBinary bool) { s.requireBinary = &requireBinary }
+
+func (s *SocketOptions) SocketReadBuffer() int {
+	if s.socketReadBuffer == nil {
+		return 0
+	}
+	return *s.socketReadBuffer
+}
+func (s *SocketOptions) GetRawSocketReadBuffer() *int { return s.socketReadBuffer }
+func (s *SocketOptions) SetSocketReadBuffer(socketReadBuffer int) {
+	s.socketReadBuffer = &socketReadBuffer
+}
+
+func (s *SocketOptions) SocketWriteBuffer() int {
+	if s.socketWriteBuffer == nil {
+		return 0
+	}
+	return *s.socketWriteBuffer
+}
+func (s *SocketOptions) GetRawSocketWriteBuffer() *int { return s.socketWriteBuffer }
+func (s *SocketOptions) SetSocketWriteBuffer(socketWriteBuffer int) {
+	s.socketWriteBuffer = &socketWriteBuffer
+}
+
+func (s *SocketOptions) MaxBufferedPackets() int {
+	if s.maxBufferedPackets == nil {
+		return 0
+	}
+	return *s.maxBufferedPackets
+}
+func (s *SocketOptions) GetRawMaxBufferedPackets() *int { return s.maxBufferedPackets }
+func (s *SocketOptions) SetMaxBufferedPackets(maxBufferedPackets int) {
+	s.maxBufferedPackets = &maxBufferedPackets
+}
+
+func (s *SocketOptions) MaxBufferedBytes() int64 {
+	if s.maxBufferedBytes == nil {
+		return 0
+	}
+	return *s.maxBufferedBytes
+}
+func (s *SocketOptions) GetRawMaxBufferedBytes() *int64 { return s.maxBufferedBytes }
+func (s *SocketOptions) SetMaxBufferedBytes(maxBufferedBytes int64) {
+	s.maxBufferedBytes = &maxBufferedBytes
+}
+
+func (s *SocketOptions) BlockOnBufferFull() bool {
+	if s.blockOnBufferFull == nil {
+		return false
+	}
+	return *s.blockOnBufferFull
+}
+func (s *SocketOptions) GetRawBlockOnBufferFull() *bool { return s.blockOnBufferFull }
+func (s *SocketOptions) SetBlockOnBufferFull(blockOnBufferFull bool) {
+	s.blockOnBufferFull = &blockOnBufferFull
+}
+
+func (s *SocketOptions) MaxPayload() int {
+	if s.maxPayload == nil {
+		return 0
+	}
+	return *s.maxPayload
+}
+func (s *SocketOptions) GetRawMaxPayload() *int       { return s.maxPayload }
+func (s *SocketOptions) SetMaxPayload(maxPayload int) { s.maxPayload = &maxPayload }
+
+func (s *SocketOptions) Recorder() *Recorder       { return s.recorder }
+func (s *SocketOptions) GetRawRecorder() *Recorder { return s.recorder }
+func (s *SocketOptions) SetRecorder(recorder *Recorder) {
+	s.recorder = recorder
+}
+
+func (s *SocketOptions) AllowedUpgrades() map[string][]string       { return s.allowedUpgrades }
+func (s *SocketOptions) GetRawAllowedUpgrades() map[string][]string { return s.allowedUpgrades }
+func (s *SocketOptions) SetAllowedUpgrades(allowedUpgrades map[string][]string) {
+	s.allowedUpgrades = allowedUpgrades
+}
+
+func (s *SocketOptions) FlushInterval() time.Duration {
+	if s.flushInterval == nil {
+		return 0
+	}
+	return *s.flushInterval
+}
+func (s *SocketOptions) GetRawFlushInterval() *time.Duration { return s.flushInterval }
+func (s *SocketOptions) SetFlushInterval(flushInterval time.Duration) {
+	s.flushInterval = &flushInterval
+}
+
+func (s *SocketOptions) FlushMaxPackets() int {
+	if s.flushMaxPackets == nil {
+		return 0
+	}
+	return *s.flushMaxPackets
+}
+func (s *SocketOptions) GetRawFlushMaxPackets() *int { return s.flushMaxPackets }
+func (s *SocketOptions) SetFlushMaxPackets(flushMaxPackets int) {
+	s.flushMaxPackets = &flushMaxPackets
+}
+
+func (s *SocketOptions) FlushMaxBytes() int64 {
+	if s.flushMaxBytes == nil {
+		return 0
+	}
+	return *s.flushMaxBytes
+}
+func (s *SocketOptions) GetRawFlushMaxBytes() *int64 { return s.flushMaxBytes }
+func (s *SocketOptions) SetFlushMaxBytes(flushMaxBytes int64) {
+	s.flushMaxBytes = &flushMaxBytes
+}
+
+func (s *SocketOptions) UpgradeProbeDelay() time.Duration {
+	if s.upgradeProbeDelay == nil {
+		return 0
+	}
+	return *s.upgradeProbeDelay
+}
+func (s *SocketOptions) GetRawUpgradeProbeDelay() *time.Duration { return s.upgradeProbeDelay }
+func (s *SocketOptions) SetUpgradeProbeDelay(upgradeProbeDelay time.Duration) {
+	s.upgradeProbeDelay = &upgradeProbeDelay
+}
+
+func (s *SocketOptions) PingTimeoutGrace() time.Duration {
+	if s.pingTimeoutGrace == nil {
+		return 0
+	}
+	return *s.pingTimeoutGrace
+}
+func (s *SocketOptions) GetRawPingTimeoutGrace() *time.Duration { return s.pingTimeoutGrace }
+func (s *SocketOptions) SetPingTimeoutGrace(pingTimeoutGrace time.Duration) {
+	s.pingTimeoutGrace = &pingTimeoutGrace
+}
+
+func (s *SocketOptions) TokenViaSubprotocol() *SubprotocolToken       { return s.tokenViaSubprotocol }
+func (s *SocketOptions) GetRawTokenViaSubprotocol() *SubprotocolToken { return s.tokenViaSubprotocol }
+
+// SetTokenViaSubprotocol offers prefix+token() as an extra subprotocol on
+// every websocket dial; token runs once per connection attempt. The token
+// entry never surfaces through the transport's Subprotocol getter.
+func (s *SocketOptions) SetTokenViaSubprotocol(prefix string, token func() string) {
+	s.tokenViaSubprotocol = &SubprotocolToken{Prefix: prefix, Token: token}
+}
+
+func (s *SocketOptions) Reconnection() bool {
+	if s.reconnection == nil {
+		return false
+	}
+	return *s.reconnection
+}
+func (s *SocketOptions) GetRawReconnection() *bool         { return s.reconnection }
+func (s *SocketOptions) SetReconnection(reconnection bool) { s.reconnection = &reconnection }
+
+func (s *SocketOptions) ReconnectionDelay() time.Duration {
+	if s.reconnectionDelay == nil {
+		return 0
+	}
+	return *s.reconnectionDelay
+}
+func (s *SocketOptions) GetRawReconnectionDelay() *time.Duration { return s.reconnectionDelay }
+func (s *SocketOptions) SetReconnectionDelay(reconnectionDelay time.Duration) {
+	s.reconnectionDelay = &reconnectionDelay
+}
+
+func (s *SocketOptions) ReconnectionDelayMax() time.Duration {
+	if s.reconnectionDelayMax == nil {
+		return 0
+	}
+	return *s.reconnectionDelayMax
+}
+func (s *SocketOptions) GetRawReconnectionDelayMax() *time.Duration { return s.reconnectionDelayMax }
+func (s *SocketOptions) SetReconnectionDelayMax(reconnectionDelayMax time.Duration) {
+	s.reconnectionDelayMax = &reconnectionDelayMax
+}
+
+func (s *SocketOptions) RandomizationFactor() float64 {
+	if s.randomizationFactor == nil {
+		return 0
+	}
+	return *s.randomizationFactor
+}
+func (s *SocketOptions) GetRawRandomizationFactor() *float64 { return s.randomizationFactor }
+func (s *SocketOptions) SetRandomizationFactor(randomizationFactor float64) {
+	s.randomizationFactor = &randomizationFactor
+}
+
+func (s *SocketOptions) MaxReconnectionAttempts() int {
+	if s.maxReconnectionAttempts == nil {
+		return 0
+	}
+	return *s.maxReconnectionAttempts
+}
+func (s *SocketOptions) GetRawMaxReconnectionAttempts() *int { return s.maxReconnectionAttempts }
+func (s *SocketOptions) SetMaxReconnectionAttempts(maxReconnectionAttempts int) {
+	s.maxReconnectionAttempts = &maxReconnectionAttempts
+}
+
+func (s *SocketOptions) MaxConcurrentWrites() int {
+	if s.maxConcurrentWrites == nil {
+		return 0
+	}
+	return *s.maxConcurrentWrites
+}
+func (s *SocketOptions) GetRawMaxConcurrentWrites() *int { return s.maxConcurrentWrites }
+func (s *SocketOptions) SetMaxConcurrentWrites(maxConcurrentWrites int) {
+	s.maxConcurrentWrites = &maxConcurrentWrites
+}
+
+func (s *SocketOptions) MaxPacketsPerBatch() int {
+	if s.maxPacketsPerBatch == nil {
+		return 0
+	}
+	return *s.maxPacketsPerBatch
+}
+func (s *SocketOptions) GetRawMaxPacketsPerBatch() *int { return s.maxPacketsPerBatch }
+func (s *SocketOptions) SetMaxPacketsPerBatch(maxPacketsPerBatch int) {
+	s.maxPacketsPerBatch = &maxPacketsPerBatch
+}
+
+func (s *SocketOptions) ReadErrorPolicy() func(error) bool       { return s.readErrorPolicy }
+func (s *SocketOptions) GetRawReadErrorPolicy() func(error) bool { return s.readErrorPolicy }
+func (s *SocketOptions) SetReadErrorPolicy(readErrorPolicy func(error) bool) {
+	s.readErrorPolicy = readErrorPolicy
+}
+
+func (s *SocketOptions) MaxConsecutiveReadErrors() int {
+	if s.maxConsecutiveReadErrors == nil {
+		return 3
+	}
+	return *s.maxConsecutiveReadErrors
+}
+func (s *SocketOptions) GetRawMaxConsecutiveReadErrors() *int { return s.maxConsecutiveReadErrors }
+func (s *SocketOptions) SetMaxConsecutiveReadErrors(maxConsecutiveReadErrors int) {
+	s.maxConsecutiveReadErrors = &maxConsecutiveReadErrors
+}
+
+func (s *SocketOptions) OpenTimeout() time.Duration {
+	if s.openTimeout == nil {
+		return 0
+	}
+	return *s.openTimeout
+}
+func (s *SocketOptions) GetRawOpenTimeout() *time.Duration { return s.openTimeout }
+func (s *SocketOptions) SetOpenTimeout(openTimeout time.Duration) {
+	s.openTimeout = &openTimeout
+}
+
+func (s *SocketOptions) ProbeTimeout() time.Duration {
+	if s.probeTimeout == nil {
+		return 0
+	}
+	return *s.probeTimeout
+}
+func (s *SocketOptions) GetRawProbeTimeout() *time.Duration { return s.probeTimeout }
+func (s *SocketOptions) SetProbeTimeout(probeTimeout time.Duration) {
+	s.probeTimeout = &probeTimeout
+}
+
+func (s *SocketOptions) PingTimeoutJitter() float64 {
+	if s.pingTimeoutJitter == nil {
+		return 0
+	}
+	return *s.pingTimeoutJitter
+}
+func (s *SocketOptions) GetRawPingTimeoutJitter() *float64 { return s.pingTimeoutJitter }
+func (s *SocketOptions) SetPingTimeoutJitter(pingTimeoutJitter float64) {
+	s.pingTimeoutJitter = &pingTimeoutJitter
+}
+
+func (s *SocketOptions) DowngradeAfterPingTimeouts() int {
+	if s.downgradeAfterPingTimeouts == nil {
+		return 0
+	}
+	return *s.downgradeAfterPingTimeouts
+}
+func (s *SocketOptions) GetRawDowngradeAfterPingTimeouts() *int { return s.downgradeAfterPingTimeouts }
+func (s *SocketOptions) SetDowngradeAfterPingTimeouts(downgradeAfterPingTimeouts int) {
+	s.downgradeAfterPingTimeouts = &downgradeAfterPingTimeouts
+}
+
+func (s *SocketOptions) RememberUpgrade() bool {
+	if s.rememberUpgrade == nil {
+		return false
+	}
+	return *s.rememberUpgrade
+}
+func (s *SocketOptions) GetRawRememberUpgrade() *bool { return s.rememberUpgrade }
+func (s *SocketOptions) SetRememberUpgrade(rememberUpgrade bool) {
+	s.rememberUpgrade = &rememberUpgrade
+}
+
+func (s *SocketOptions) TransportOptions() map[string]SocketOptionsInterface {
+	return s.transportOptions
+}
+func (s *SocketOptions) GetRawTransportOptions() map[string]SocketOptionsInterface {
+	return s.transportOptions
+}
+func (s *SocketOptions) SetTransportOptions(transportOptions map[string]SocketOptionsInterface) {
+	s.transportOptions = transportOptions
+}
+
+func (s *SocketOptions) SelectInitialTransport() func(available []string) string {
+	return s.selectInitialTransport
+}
+func (s *SocketOptions) GetRawSelectInitialTransport() func(available []string) string {
+	return s.selectInitialTransport
+}
+func (s *SocketOptions) SetSelectInitialTransport(selectInitialTransport func(available []string) string) {
+	s.selectInitialTransport = selectInitialTransport
+}
+
+func (s *SocketOptions) WebTransportRouting() func(*packet.Packet) bool {
+	return s.webTransportRouting
+}
+func (s *SocketOptions) GetRawWebTransportRouting() func(*packet.Packet) bool {
+	return s.webTransportRouting
+}
+func (s *SocketOptions) SetWebTransportRouting(webTransportRouting func(*packet.Packet) bool) {
+	s.webTransportRouting = webTransportRouting
+}
+
+func (s *SocketOptions) HandshakePacketTimeout() time.Duration {
+	if s.handshakePacketTimeout == nil {
+		return 0
+	}
+	return *s.handshakePacketTimeout
+}
+func (s *SocketOptions) GetRawHandshakePacketTimeout() *time.Duration {
+	return s.handshakePacketTimeout
+}
+func (s *SocketOptions) SetHandshakePacketTimeout(handshakePacketTimeout time.Duration) {
+	s.handshakePacketTimeout = &handshakePacketTimeout
+}
+
+func (s *SocketOptions) ErrorPacketMatcher() func(*packet.Packet) error {
+	return s.errorPacketMatcher
+}
+func (s *SocketOptions) GetRawErrorPacketMatcher() func(*packet.Packet) error {
+	return s.errorPacketMatcher
+}
+func (s *SocketOptions) SetErrorPacketMatcher(errorPacketMatcher func(*packet.Packet) error) {
+	s.errorPacketMatcher = errorPacketMatcher
+}
+
+func (s *SocketOptions) CloseOnErrorPacket() bool {
+	if s.closeOnErrorPacket == nil {
+		return false
+	}
+	return *s.closeOnErrorPacket
+}
+func (s *SocketOptions) GetRawCloseOnErrorPacket() *bool { return s.closeOnErrorPacket }
+func (s *SocketOptions) SetCloseOnErrorPacket(closeOnErrorPacket bool) {
+	s.closeOnErrorPacket = &closeOnErrorPacket
+}
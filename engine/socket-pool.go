@@ -0,0 +1,129 @@
+package engine
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zishang520/engine.io/v2/events"
+	"github.com/zishang520/engine.io/v2/log"
+)
+
+var client_socket_pool_log = log.NewLog("engine.io-client:socket-pool")
+
+// poolEntry tracks one registered socket: when it was last active and the
+// listeners to detach when it leaves the pool.
+type poolEntry struct {
+	lastActive time.Time
+	onActivity events.Listener
+	onClose    events.Listener
+}
+
+// SocketPool enforces a shared connection budget across many sockets, for
+// processes like gateways that hold one socket per downstream peer. Every
+// registered socket's activity is tracked by its last packet time (received
+// or flushed); when registrations push the pool past its cap the
+// least-recently-active socket receives an "evicted" event and is gracefully
+// closed. Registration is opt-in - sockets outside a pool are untouched.
+type SocketPool struct {
+	mu       sync.Mutex
+	capacity int
+	sockets  map[SocketWithoutUpgrade]*poolEntry
+}
+
+// NewSocketPool returns a pool evicting down to capacity open sockets. A
+// capacity of zero or less disables eviction, leaving only the activity
+// tracking.
+func NewSocketPool(capacity int) *SocketPool {
+	return &SocketPool{
+		capacity: capacity,
+		sockets:  map[SocketWithoutUpgrade]*poolEntry{},
+	}
+}
+
+// Add registers the socket with the pool, evicting the least-recently-active
+// socket when the cap is now exceeded. Sockets remove themselves when they
+// close.
+func (p *SocketPool) Add(socket SocketWithoutUpgrade) {
+	p.mu.Lock()
+	if _, ok := p.sockets[socket]; ok {
+		p.mu.Unlock()
+		return
+	}
+
+	entry := &poolEntry{lastActive: time.Now()}
+	entry.onActivity = func(...any) {
+		p.mu.Lock()
+		if e, ok := p.sockets[socket]; ok {
+			e.lastActive = time.Now()
+		}
+		p.mu.Unlock()
+	}
+	entry.onClose = func(...any) {
+		p.Remove(socket)
+	}
+
+	p.sockets[socket] = entry
+	p.mu.Unlock()
+
+	socket.On(EventPacket, entry.onActivity)
+	socket.On(EventFlush, entry.onActivity)
+	socket.Once(EventClose, entry.onClose)
+
+	p.enforce()
+}
+
+// Remove detaches the socket from the pool without closing it.
+func (p *SocketPool) Remove(socket SocketWithoutUpgrade) {
+	p.mu.Lock()
+	entry, ok := p.sockets[socket]
+	if ok {
+		delete(p.sockets, socket)
+	}
+	p.mu.Unlock()
+
+	if ok {
+		socket.RemoveListener(EventPacket, entry.onActivity)
+		socket.RemoveListener(EventFlush, entry.onActivity)
+		socket.RemoveListener(EventClose, entry.onClose)
+	}
+}
+
+// Len returns the number of registered sockets.
+func (p *SocketPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.sockets)
+}
+
+// enforce closes least-recently-active sockets until the pool fits its cap.
+func (p *SocketPool) enforce() {
+	if p.capacity <= 0 {
+		return
+	}
+
+	for {
+		p.mu.Lock()
+		if len(p.sockets) <= p.capacity {
+			p.mu.Unlock()
+			return
+		}
+
+		var victim SocketWithoutUpgrade
+		var oldest time.Time
+		for socket, entry := range p.sockets {
+			if victim == nil || entry.lastActive.Before(oldest) {
+				victim, oldest = socket, entry.lastActive
+			}
+		}
+		p.mu.Unlock()
+
+		client_socket_pool_log.Debug(`evicting socket "%s" - pool over capacity`, victim.Id())
+		victim.Emit(EventEvicted)
+		victim.Close()
+
+		// The close listener removes the socket; make sure it is gone even
+		// when the socket was never open.
+		p.Remove(victim)
+	}
+}
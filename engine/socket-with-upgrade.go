@@ -0,0 +1,502 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zishang520/engine.io-go-parser/packet"
+	_types "github.com/zishang520/engine.io-go-parser/types"
+	"github.com/zishang520/engine.io/v2/log"
+	"github.com/zishang520/engine.io/v2/types"
+	"github.com/zishang520/engine.io/v2/utils"
+)
+
+var client_socket_with_upgrade_log = log.NewLog("engine.io-client:socket-with-upgrade")
+
+// UpgradeInfo describes a completed transport upgrade: the transport names
+// involved and how long the probe took from its start to the promotion. It
+// rides the "upgrade" event after the new Transport, a data point for tuning
+// probe delays.
+type UpgradeInfo struct {
+	From     string
+	To       string
+	Duration time.Duration
+}
+
+// socketWithUpgrade adds the transport upgrade machinery on top of
+// socketWithoutUpgrade: once the initial transport is open, every
+// server-offered upgrade is probed with a PING/PONG handshake and the first
+// one to answer takes over.
+type socketWithUpgrade struct {
+	SocketWithoutUpgrade
+
+	_upgradesMu sync.RWMutex
+	_upgrades   *types.Set[string]
+
+	// availableUpgrades snapshots the post-filter upgrade list of the last
+	// handshake; unlike _upgrades it survives ClearUpgrades.
+	availableUpgrades []string
+
+	// filterWarnOnce gates the misconfiguration warning logged when the
+	// server offers upgrades but the configured transports match none.
+	filterWarnOnce sync.Once
+
+	// activeProbes holds the freeze functions of in-flight upgrade probes,
+	// lifted out of _probe's closures so AbortUpgrade can reach them.
+	probeMu      sync.Mutex
+	activeProbes map[*probeState]struct{}
+}
+
+// probeState is the externally reachable handle of one in-flight probe; its
+// freeze function runs the probe's freeze/cleanup path.
+type probeState struct {
+	freeze func()
+}
+
+// MakeSocketWithUpgrade returns a socket yet to be constructed.
+func MakeSocketWithUpgrade() SocketWithUpgrade {
+	s := &socketWithUpgrade{
+		SocketWithoutUpgrade: MakeSocketWithoutUpgrade(),
+
+		_upgrades: types.NewSet[string](),
+
+		activeProbes: map[*probeState]struct{}{},
+	}
+
+	s.Prototype(s)
+
+	// A degrading active transport (see TransportErrorThreshold) triggers a
+	// fresh probe of the remaining upgrades so the socket can self-heal.
+	s.On(EventTransportDegraded, func(...any) {
+		if SocketStateOpen != s.ReadyState() || !s.Opts().Upgrade() {
+			return
+		}
+
+		current := ""
+		if transport := s.Transport(); transport != nil {
+			current = transport.Name()
+		}
+
+		s._upgradesMu.RLock()
+		upgrades := s._upgrades.All()
+		s._upgradesMu.RUnlock()
+
+		for upgrade := range upgrades {
+			if upgrade != current && s._upgradeAllowed(current, upgrade) && !s.TransportProblematic(upgrade) {
+				client_socket_with_upgrade_log.Debug(`re-probing transport "%s" after "%s" degraded`, upgrade, current)
+				s._probe(upgrade)
+			}
+		}
+	})
+
+	return s
+}
+
+// NewSocketWithUpgrade creates a socket that upgrades its transport when the
+// server allows it, and opens it immediately.
+func NewSocketWithUpgrade(uri string, opts SocketOptionsInterface) SocketWithUpgrade {
+	s := MakeSocketWithUpgrade()
+
+	s.Construct(uri, opts)
+
+	return s
+}
+
+// NewSocketWithUpgradeContext is like NewSocketWithUpgrade but ties the
+// socket's lifetime to ctx; see NewSocketWithoutUpgradeContext.
+func NewSocketWithUpgradeContext(ctx context.Context, uri string, opts SocketOptionsInterface) SocketWithUpgrade {
+	s := MakeSocketWithUpgrade()
+
+	s.SetContext(ctx)
+	s.Construct(uri, opts)
+
+	return s
+}
+
+func (s *socketWithUpgrade) OnOpen() {
+	s.SocketWithoutUpgrade.OnOpen()
+
+	if SocketStateOpen == s.ReadyState() && s.Opts().Upgrade() {
+		client_socket_with_upgrade_log.Debug("starting upgrade probes")
+		current := ""
+		if transport := s.Transport(); transport != nil {
+			current = transport.Name()
+		}
+
+		s._upgradesMu.RLock()
+		upgrades := s._upgrades.All()
+		s._upgradesMu.RUnlock()
+
+		for upgrade := range upgrades {
+			if !s._upgradeAllowed(current, upgrade) {
+				client_socket_with_upgrade_log.Debug(`upgrade "%s" -> "%s" not in AllowedUpgrades - skipping probe`, current, upgrade)
+				continue
+			}
+			if s.TransportProblematic(upgrade) {
+				client_socket_with_upgrade_log.Debug(`upgrade "%s" marked problematic by ping timeouts - skipping probe`, upgrade)
+				continue
+			}
+			s._probe(upgrade)
+		}
+	}
+}
+
+func (s *socketWithUpgrade) OnHandshake(data *HandshakeData) {
+	filtered := s._filterUpgrades(data.Upgrades)
+	configured := s.Transports().Keys()
+
+	s._upgradesMu.Lock()
+	s._upgrades = types.NewSet(filtered...)
+	s.availableUpgrades = filtered
+	s._upgradesMu.Unlock()
+
+	client_socket_with_upgrade_log.Debug("upgrades filtered: server %v, configured %v, usable %v", data.Upgrades, configured, filtered)
+	s.Emit(EventUpgradesFiltered, data.Upgrades, configured, filtered)
+
+	if len(filtered) == 0 && len(data.Upgrades) > 0 {
+		s.filterWarnOnce.Do(func() {
+			client_socket_with_upgrade_log.Warning(
+				"server offered upgrades %v but none is in the configured transports %v - check SocketOptions.Transports",
+				data.Upgrades, configured)
+		})
+	}
+
+	s.SocketWithoutUpgrade.OnHandshake(data)
+}
+
+// Upgrades returns a copy of the upgrades negotiated for the current
+// connection: the server-offered ones this client was configured with, minus
+// any cleared via ClearUpgrades. It is empty before the handshake.
+func (s *socketWithUpgrade) Upgrades() []string {
+	s._upgradesMu.RLock()
+	defer s._upgradesMu.RUnlock()
+
+	return s._upgrades.Keys()
+}
+
+// ClearUpgrades empties the upgrades set, preventing further upgrade attempts
+// on the current connection. Probes already in flight are not interrupted,
+// and a reconnect restores the set from the next handshake.
+func (s *socketWithUpgrade) ClearUpgrades() {
+	s._upgradesMu.Lock()
+	defer s._upgradesMu.Unlock()
+
+	s._upgrades.Clear()
+}
+
+// AvailableUpgrades returns the post-filter upgrade list of the last
+// handshake: the server-offered upgrades this client was configured with.
+// Unlike Upgrades it is not affected by ClearUpgrades, so it keeps reflecting
+// the filtering outcome. It is empty before the handshake.
+func (s *socketWithUpgrade) AvailableUpgrades() []string {
+	s._upgradesMu.RLock()
+	defer s._upgradesMu.RUnlock()
+
+	return append([]string{}, s.availableUpgrades...)
+}
+
+// _upgradeAllowed consults the AllowedUpgrades allowlist for the from -> to
+// transition; an unset option permits everything.
+func (s *socketWithUpgrade) _upgradeAllowed(from string, to string) bool {
+	allowed := s.Opts().AllowedUpgrades()
+	if allowed == nil {
+		return true
+	}
+
+	for _, name := range allowed[from] {
+		if name == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// _filterUpgrades keeps only the server-offered upgrades this client was
+// configured with.
+func (s *socketWithUpgrade) _filterUpgrades(upgrades []string) []string {
+	filtered := []string{}
+	for _, upgrade := range upgrades {
+		if s.Transports().Has(upgrade) {
+			filtered = append(filtered, upgrade)
+		}
+	}
+
+	return filtered
+}
+
+// AbortUpgrade cancels any upgrade probe still in flight - for when the
+// application decides an upgrade is undesirable right now (a metered
+// connection toggle, say). Each active probe runs its freeze/cleanup path and
+// its candidate transport is closed; "upgradeAborted" fires once. It reports
+// whether anything was actually aborted. The current transport keeps working
+// either way, and future handshakes may probe again.
+func (s *socketWithUpgrade) AbortUpgrade() bool {
+	s.probeMu.Lock()
+	probes := make([]*probeState, 0, len(s.activeProbes))
+	for ps := range s.activeProbes {
+		probes = append(probes, ps)
+	}
+	s.probeMu.Unlock()
+
+	if len(probes) == 0 {
+		return false
+	}
+
+	client_socket_with_upgrade_log.Debug("aborting %d in-flight upgrade probe(s)", len(probes))
+	for _, ps := range probes {
+		ps.freeze()
+	}
+	s.SetUpgrading(false)
+	s.Emit(EventUpgradeAborted)
+
+	return true
+}
+
+// ProbeUpgrade triggers an upgrade probe of the named transport on demand -
+// for apps that learn of a network change (Wi-Fi came back, say) and want to
+// retry upgrading without reconnecting. The name must be among the upgrades
+// negotiated for the current connection and not the active transport; the
+// socket must be open. The probe itself runs like any other: the transport
+// only swaps once the probe PING/PONG succeeds, and failures surface as
+// "upgradeError" events.
+func (s *socketWithUpgrade) ProbeUpgrade(name string) error {
+	if SocketStateOpen != s.ReadyState() {
+		return ErrSocketClosed
+	}
+
+	if transport := s.Transport(); transport != nil && transport.Name() == name {
+		return fmt.Errorf("transport %q is already active", name)
+	}
+
+	s._upgradesMu.RLock()
+	known := s._upgrades.Has(name)
+	s._upgradesMu.RUnlock()
+	if !known {
+		return fmt.Errorf("transport %q is not among the negotiated upgrades", name)
+	}
+
+	s._probe(name)
+
+	return nil
+}
+
+// _probe opens a candidate transport and, on a successful "probe" PING/PONG
+// round trip, pauses the current transport and promotes the candidate.
+func (s *socketWithUpgrade) _probe(name string) {
+	client_socket_with_upgrade_log.Debug(`probing transport "%s"`, name)
+
+	probeStart := time.Now()
+
+	transport, err := s.CreateTransport(name)
+	if err != nil {
+		client_socket_with_upgrade_log.Debug(`error while creating transport "%s": %v`, name, err)
+		s.Emit(EventUpgradeError, NewError("probe error", err, name))
+		return
+	}
+
+	var failed atomic.Bool
+
+	s.SetPriorWebsocketSuccess(false)
+
+	var cleanup func()
+
+	// The probe timer is armed after the listeners below are live, and any
+	// of them can race into cleanup from its own goroutine; the mutex orders
+	// the arming against the clear, and probeDone keeps a late arming from
+	// outliving a cleanup that already ran.
+	var probeTimerMu sync.Mutex
+	var probeTimer *utils.Timer
+	var probeDone bool
+
+	ps := &probeState{}
+
+	onTransportOpen := func(...any) {
+		if failed.Load() {
+			return
+		}
+
+		client_socket_with_upgrade_log.Debug(`probe transport "%s" opened`, name)
+		transport.Send([]*packet.Packet{
+			{
+				Type: packet.PING,
+				Data: _types.NewStringBufferString("probe"),
+			},
+		})
+		transport.Once(EventPacket, func(msgs ...any) {
+			if failed.Load() {
+				return
+			}
+			if len(msgs) == 0 {
+				return
+			}
+			msg, ok := msgs[0].(*packet.Packet)
+			if !ok {
+				return
+			}
+
+			msgData, _ := msg.Data.(_types.BufferInterface)
+
+			if packet.PONG == msg.Type && msgData != nil && "probe" == msgData.String() {
+				client_socket_with_upgrade_log.Debug(`probe transport "%s" pong`, name)
+
+				s.SetUpgrading(true)
+				s.Emit(EventUpgrading, transport)
+				s.SetPriorWebsocketSuccess("websocket" == transport.Name())
+
+				from := s.Transport().Name()
+				client_socket_with_upgrade_log.Debug(`pausing current transport "%s"`, from)
+				s.Transport().Pause(func() {
+					if failed.Load() {
+						return
+					}
+					if SocketStateClosed == s.ReadyState() {
+						return
+					}
+					client_socket_with_upgrade_log.Debug("changing transport and sending upgrade packet")
+
+					cleanup()
+
+					// Queued rather than sent directly: the drain event of a
+					// dedicated writer would cross wires with a concurrent
+					// flush; queueControlPacket keeps the accounting intact.
+					s.QueueControlPacket(&packet.Packet{Type: packet.UPGRADE})
+					s.SetTransport(transport)
+					s.Emit(EventUpgrade, transport, &UpgradeInfo{
+						From:     from,
+						To:       transport.Name(),
+						Duration: time.Since(probeStart),
+					})
+					s.SetUpgrading(false)
+					s.Flush()
+				})
+			} else {
+				client_socket_with_upgrade_log.Debug(`probe transport "%s" failed`, name)
+				s.Emit(EventUpgradeError, NewError("probe error", nil, transport.Name()))
+			}
+		})
+	}
+
+	freezeTransport := func() {
+		if !failed.CompareAndSwap(false, true) {
+			return
+		}
+
+		cleanup()
+
+		transport.Close()
+	}
+
+	ps.freeze = freezeTransport
+	s.probeMu.Lock()
+	s.activeProbes[ps] = struct{}{}
+	s.probeMu.Unlock()
+
+	// Handle any error that happens while probing.
+	onerror := func(errs ...any) {
+		var description error
+		if len(errs) > 0 {
+			description, _ = errs[0].(error)
+		}
+		err := NewError("probe error", description, transport.Name())
+
+		freezeTransport()
+
+		client_socket_with_upgrade_log.Debug(`probe transport "%s" failed because of error: %v`, name, description)
+
+		s.Emit(EventUpgradeError, err)
+	}
+
+	onTransportClose := func(...any) {
+		onerror(errors.New("transport closed"))
+	}
+
+	// When the socket is closed while we're probing.
+	onclose := func(...any) {
+		onerror(errors.New("socket closed"))
+	}
+
+	// When the socket is upgraded while we're probing.
+	onupgrade := func(args ...any) {
+		if len(args) == 0 {
+			return
+		}
+		if to, ok := args[0].(Transport); ok && to.Name() != transport.Name() {
+			client_socket_with_upgrade_log.Debug(`"%s" works - aborting "%s"`, to.Name(), transport.Name())
+			freezeTransport()
+		}
+	}
+
+	// Remove all listeners on the transport and on self.
+	cleanup = func() {
+		s.probeMu.Lock()
+		delete(s.activeProbes, ps)
+		s.probeMu.Unlock()
+
+		probeTimerMu.Lock()
+		probeDone = true
+		utils.ClearTimeout(probeTimer)
+		probeTimerMu.Unlock()
+
+		transport.RemoveListener(EventOpen, onTransportOpen)
+		transport.RemoveListener(EventError, onerror)
+		transport.RemoveListener(EventClose, onTransportClose)
+		s.RemoveListener(EventClose, onclose)
+		s.RemoveListener(EventUpgrading, onupgrade)
+	}
+
+	transport.Once(EventOpen, onTransportOpen)
+	transport.Once(EventError, onerror)
+	transport.Once(EventClose, onTransportClose)
+
+	s.Once(EventClose, onclose)
+	s.Once(EventUpgrading, onupgrade)
+
+	// A probe the server never answers (broken proxy) must not leave the
+	// candidate transport and these listeners behind for the life of the
+	// connection; bound the wait.
+	probeTimeout := 10 * time.Second
+	if s.Opts().GetRawProbeTimeout() != nil {
+		probeTimeout = s.Opts().ProbeTimeout()
+	}
+	if probeTimeout > 0 {
+		probeTimerMu.Lock()
+		if !probeDone {
+			probeTimer = utils.SetTimeout(func() {
+				if failed.Load() {
+					return
+				}
+				client_socket_with_upgrade_log.Debug(`probe transport "%s" timed out after %v`, name, probeTimeout)
+				onerror(&TimeoutError{Op: "probe", After: probeTimeout})
+			}, probeTimeout)
+		}
+		probeTimerMu.Unlock()
+	}
+
+	s._upgradesMu.RLock()
+	favorsWebTransport := s._upgrades.Has("webtransport") && "webtransport" != name
+	s._upgradesMu.RUnlock()
+
+	// The head start WebTransport gets; tunable (or zeroed out entirely) via
+	// UpgradeProbeDelay.
+	probeDelay := 200 * time.Millisecond
+	if s.Opts().GetRawUpgradeProbeDelay() != nil {
+		probeDelay = s.Opts().UpgradeProbeDelay()
+	}
+
+	if favorsWebTransport && probeDelay > 0 {
+		// Favor WebTransport: give it a head start before probing the other
+		// upgrades.
+		utils.SetTimeout(func() {
+			if !failed.Load() {
+				transport.Open()
+			}
+		}, probeDelay)
+	} else {
+		transport.Open()
+	}
+}
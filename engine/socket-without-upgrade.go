@@ -0,0 +1,2541 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/url"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zishang520/engine.io-go-parser/packet"
+	_types "github.com/zishang520/engine.io-go-parser/types"
+	"github.com/zishang520/engine.io/v2/events"
+	"github.com/zishang520/engine.io/v2/log"
+	"github.com/zishang520/engine.io/v2/types"
+	"github.com/zishang520/engine.io/v2/utils"
+)
+
+var client_socket_log = log.NewLog("engine.io-client:socket")
+
+// HandshakeData is the payload of the OPEN packet sent by the server.
+type HandshakeData struct {
+	Sid          string   `json:"sid"`
+	Upgrades     []string `json:"upgrades"`
+	PingInterval int64    `json:"pingInterval"`
+	PingTimeout  int64    `json:"pingTimeout"`
+	MaxPayload   int64    `json:"maxPayload"`
+
+	// Codec echoes the payload codec name offered via the "codec" query
+	// parameter when the server supports it; see PayloadCodec.
+	Codec string `json:"codec,omitempty"`
+}
+
+// priorWebsocketSuccess remembers, across sockets, whether the last WebSocket
+// connection attempt succeeded (mirrors the static flag of the JS client).
+var priorWebsocketSuccess atomic.Bool
+
+// socketWithoutUpgrade is the base socket implementation: it opens a single
+// transport and never upgrades it. socketWithUpgrade layers the probe
+// machinery on top through the prototype.
+type socketWithoutUpgrade struct {
+	events.EventEmitter
+
+	proto SocketWithoutUpgrade
+
+	id   atomic.Value // string
+	opts SocketOptionsInterface
+
+	// handshake holds the server's handshake data once OnHandshake ran; a
+	// reconnect's new handshake replaces it.
+	handshake atomic.Pointer[HandshakeData]
+
+	// ctx, when bound via a *Context constructor, closes the socket upon
+	// cancellation. done signals the waiters of the current connection
+	// attempt once it reaches its close; a reconnect revives the same
+	// socket, so each Open hands out a fresh channel (see doneChan).
+	ctx    context.Context
+	doneMu sync.Mutex
+	done   chan struct{}
+
+	// closedOnce guards the terminal-close notification: the OnClosed
+	// callbacks run exactly once, when the socket is closed with no
+	// reconnect pending, however many close paths converge there.
+	closedOnce      sync.Once
+	closedMu        sync.Mutex
+	closedCallbacks []func(error)
+	closedFired     bool
+	closedReason    error
+
+	// wsShortcut flags a RememberUpgrade websocket-first attempt between
+	// Open and its outcome, so a pre-open failure can fall back to the
+	// normal transport ordering.
+	wsShortcut atomic.Bool
+
+	mu            sync.RWMutex
+	transport     Transport
+	readyState    SocketState
+	writeBuffer   []*packet.Packet
+	prevBufferLen int
+
+	// writeCallbacks runs parallel to writeBuffer, one (possibly nil) entry
+	// per queued packet. A callback fires only once its batch has settled on
+	// the transport: with nil after a confirmed write, with the write error
+	// otherwise.
+	writeCallbacks []func(error)
+
+	// bufferedBytes tracks the payload bytes sitting in writeBuffer, backing
+	// the MaxBufferedBytes cap and BufferedAmount.
+	bufferedBytes int64
+
+	// bufferRoom, when non-nil, is closed as soon as the write buffer frees
+	// space, waking senders blocked by a buffer cap (BlockOnBufferFull).
+	bufferRoom chan struct{}
+
+	// droppedPackets counts volatile sends dropped because the transport
+	// was not ready to take them; see SendVolatile.
+	droppedPackets atomic.Uint64
+
+	// wildcards holds the OnAny listeners notified on every Emit.
+	wildcards anyListeners
+
+	// reconnectAttempts counts consecutive failed connections while the
+	// Reconnection option is retrying; a successful open resets it.
+	reconnectAttempts atomic.Int64
+
+	// generation counts the connections this socket has opened. Everything
+	// bound to one connection - transport listeners, the heartbeat timer, the
+	// close drain wait - is stamped with the generation it was armed in and
+	// drops its event when a reconnect has moved the socket on, so a late
+	// callback from a dead connection cannot corrupt the live one.
+	generation atomic.Uint64
+
+	transports *types.Set[string]
+	upgrading  atomic.Bool
+
+	// codecActive reports whether the handshake acknowledged the configured
+	// payload codec; see PayloadCodec.
+	codecActive atomic.Bool
+
+	// stateMu serializes readyState transitions with their OnStateChange
+	// notifications.
+	stateMu       sync.Mutex
+	stateHandlers []func(old SocketState, new SocketState)
+
+	// datagramNotified dedupes the "datagramUnavailable" event: it is emitted
+	// once per transport, not once per failed datagram-preferred send.
+	datagramNotified atomic.Bool
+
+	pingInterval atomic.Int64 // time.Duration
+	pingTimeout  atomic.Int64 // time.Duration
+	maxPayload   atomic.Int64
+
+	// pongSentAt notes when the last heartbeat PONG was confirmed written;
+	// lastRTT and avgRTT hold the round-trip estimates derived from it. See
+	// sampleHeartbeatRTT.
+	pongSentAt atomic.Value // time.Time
+	lastRTT    atomic.Int64 // time.Duration
+	avgRTT     atomic.Int64 // time.Duration
+
+	timerMu          sync.Mutex
+	pingTimeoutTimer *utils.Timer
+	// pingTimeoutTime is the heartbeat deadline as Unix nanoseconds, zero
+	// when no deadline is armed. The fixed integer typing keeps the load
+	// site from ever seeing a differently-typed value.
+	pingTimeoutTime atomic.Int64
+
+	// v3PingTimer drives the client-initiated heartbeat of EIO=3
+	// compatibility mode; see _schedulePing. Unused on protocol v4.
+	v3PingTimerMu sync.Mutex
+	v3PingTimer   *utils.Timer
+
+	// flushTimer is the pending coalescing flush armed when FlushInterval is
+	// configured; see maybeFlush.
+	flushTimerMu sync.Mutex
+	flushTimer   *utils.Timer
+
+	// openTimer bounds the time spent in the opening state when OpenTimeout
+	// is configured; cancelled once the socket opens or closes.
+	openTimerMu sync.Mutex
+	openTimer   *utils.Timer
+
+	// handshakeTimer bounds the transport-open -> OPEN-packet phase when
+	// HandshakePacketTimeout is configured.
+	handshakeTimerMu sync.Mutex
+	handshakeTimer   *utils.Timer
+
+	// Per-attempt connect phase stamps and durations; see ConnectTimings.
+	timingsMu       sync.Mutex
+	timings         ConnectTimings
+	dialStartAt     time.Time
+	transportOpenAt time.Time
+	openAt          time.Time
+
+	// connectionPath lists the transport names this connection has gone
+	// through, in order ("polling" then "websocket" for an upgraded session);
+	// a reconnect starts a fresh path.
+	pathMu         sync.Mutex
+	connectionPath []string
+
+	// packetCounts tallies every packet crossing the socket by type, both
+	// directions combined; see PacketCounts.
+	packetCountsMu sync.Mutex
+	packetCounts   map[packet.Type]uint64
+
+	// pastStats accumulates the wire-level accounting of transports this
+	// socket no longer uses (e.g. polling after an upgrade).
+	statsMu   sync.Mutex
+	pastStats map[string]TransportStats
+
+	// transportErrors holds the trailing-minute error timestamps per
+	// transport, backing the TransportErrorThreshold accounting.
+	transportErrMu  sync.Mutex
+	transportErrors map[string][]time.Time
+
+	// pingTimeouts counts "ping timeout" closes per transport name, and
+	// problemTransports the ones that crossed DowngradeAfterPingTimeouts;
+	// Open and the upgrade probes steer around those.
+	pingTimeoutsMu    sync.Mutex
+	pingTimeouts      map[string]int
+	problemTransports map[string]bool
+}
+
+// MakeSocketWithoutUpgrade returns a socket yet to be constructed.
+func MakeSocketWithoutUpgrade() SocketWithoutUpgrade {
+	s := &socketWithoutUpgrade{
+		EventEmitter: events.New(),
+
+		done:            make(chan struct{}),
+		packetCounts:    map[packet.Type]uint64{},
+		pastStats:       map[string]TransportStats{},
+		transportErrors: map[string][]time.Time{},
+
+		pingTimeouts:      map[string]int{},
+		problemTransports: map[string]bool{},
+	}
+	s.readyState = ""
+	s.id.Store("")
+	s.pongSentAt.Store(time.Time{})
+
+	s.Prototype(s)
+
+	return s
+}
+
+// NewSocketWithoutUpgrade creates a socket bound to a single transport and
+// opens it immediately.
+func NewSocketWithoutUpgrade(uri string, opts SocketOptionsInterface) SocketWithoutUpgrade {
+	s := MakeSocketWithoutUpgrade()
+
+	s.Construct(uri, opts)
+
+	return s
+}
+
+// NewSocketWithoutUpgradeContext is like NewSocketWithoutUpgrade but ties the
+// socket's lifetime to ctx: cancellation closes the socket and aborts any
+// in-flight request or dial, surfacing ctx.Err() in the "close" event.
+func NewSocketWithoutUpgradeContext(ctx context.Context, uri string, opts SocketOptionsInterface) SocketWithoutUpgrade {
+	s := MakeSocketWithoutUpgrade()
+
+	s.SetContext(ctx)
+	s.Construct(uri, opts)
+
+	return s
+}
+
+func (s *socketWithoutUpgrade) Prototype(proto SocketWithoutUpgrade) {
+	s.proto = proto
+}
+
+func (s *socketWithoutUpgrade) Proto() SocketWithoutUpgrade {
+	return s.proto
+}
+
+func (s *socketWithoutUpgrade) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// SetContext binds the socket to ctx. It must be called before Construct;
+// the *Context constructors take care of that.
+func (s *socketWithoutUpgrade) SetContext(ctx context.Context) {
+	s.ctx = ctx
+}
+
+func (s *socketWithoutUpgrade) Construct(uri string, opts SocketOptionsInterface) {
+	// The package-wide base (SetDefaultSocketOptions) seeds the snapshot;
+	// per-socket opts layer over it, and the fallbacks below only fill what
+	// neither provided.
+	s.opts = DefaultSocketOptions().Assign(opts)
+
+	if uri != "" {
+		if parsed, err := url.Parse(uri); err == nil {
+			s.opts.SetHostname(parsed.Hostname())
+			s.opts.SetSecure(parsed.Scheme == "https" || parsed.Scheme == "wss")
+			s.opts.SetPort(parsed.Port())
+
+			if parsed.Path != "" && parsed.Path != "/" {
+				s.opts.SetPath(parsed.Path)
+			}
+
+			// Query parameters in the URI are honored like the JavaScript
+			// client does, merged under any explicit opts.Query() values so
+			// conflicts resolve in favor of the options.
+			if uriQuery := parsed.Query(); len(uriQuery) > 0 {
+				query := url.Values{}
+				for key, values := range uriQuery {
+					query[key] = values
+				}
+				for key, values := range s.opts.Query() {
+					query[key] = values
+				}
+				s.opts.SetQuery(query)
+			}
+		}
+	}
+
+	if s.opts.GetRawHostname() == nil {
+		s.opts.SetHostname("localhost")
+	}
+	if s.opts.Port() == "" {
+		if s.opts.Secure() {
+			s.opts.SetPort("443")
+		} else {
+			s.opts.SetPort("80")
+		}
+	}
+	if s.opts.GetRawPath() == nil {
+		s.opts.SetPath("/engine.io")
+	}
+	if s.opts.GetRawTimestampParam() == nil {
+		s.opts.SetTimestampParam("t")
+	}
+	if s.opts.GetRawUpgrade() == nil {
+		s.opts.SetUpgrade(true)
+	}
+	if s.opts.GetRawQuery() == nil {
+		s.opts.SetQuery(url.Values{})
+	}
+	if codec := s.opts.PayloadCodec(); codec != nil {
+		s.opts.Query().Set(codecQueryParam, codec.Name())
+	}
+	if s.opts.GetRawUserAgent() == nil {
+		s.opts.SetUserAgent("engine.io-client-go/" + Version)
+	}
+
+	if rec := s.opts.Recorder(); rec != nil {
+		s.attachRecorder(rec)
+	}
+
+	// Stamp the open -> upgrade-complete phase of the connect timings; the
+	// upgrade machinery lives a layer up, so the socket listens to itself.
+	s.On(EventUpgrade, func(...any) {
+		s.timingsMu.Lock()
+		if !s.openAt.IsZero() {
+			s.timings.Upgrade = time.Since(s.openAt)
+		}
+		s.timingsMu.Unlock()
+	})
+
+	if transports := s.opts.Transports(); transports != nil && transports.Len() > 0 {
+		s.transports = transports
+	} else {
+		s.transports = types.NewSet("polling", "websocket", "webtransport")
+	}
+
+	if s.ctx != nil {
+		s.watchContext()
+	}
+
+	s.proto.Open()
+}
+
+// watchContext ties the socket's lifetime to the bound context for the
+// current connection attempt; the watcher exits once that attempt closes,
+// and every reconnect arms a new one (see Open).
+func (s *socketWithoutUpgrade) watchContext() {
+	done := s.doneChan()
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			client_socket_log.Debug("bound context canceled - closing socket")
+			s.proto.OnClose("context canceled", s.ctx.Err())
+		case <-done:
+		}
+	}()
+}
+
+// doneChan returns the channel closed when the current connection attempt
+// reaches its close; each Open replaces a spent channel, so waiters must
+// grab it before blocking rather than hold one across attempts.
+func (s *socketWithoutUpgrade) doneChan() chan struct{} {
+	s.doneMu.Lock()
+	defer s.doneMu.Unlock()
+
+	return s.done
+}
+
+// closeDone signals the current attempt's waiters, exactly once per channel.
+func (s *socketWithoutUpgrade) closeDone() {
+	s.doneMu.Lock()
+	defer s.doneMu.Unlock()
+
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+}
+
+func (s *socketWithoutUpgrade) Id() string {
+	return s.id.Load().(string)
+}
+
+// ConnectionPath returns the ordered transport names this connection has
+// used: ["polling", "websocket"] for a session that upgraded, ["websocket"]
+// for one that connected directly. A reconnect starts a fresh path. It also
+// rides the *CloseDetails of the "close" event, so disconnect logs can show
+// what the session looked like.
+func (s *socketWithoutUpgrade) ConnectionPath() []string {
+	s.pathMu.Lock()
+	defer s.pathMu.Unlock()
+
+	return append([]string(nil), s.connectionPath...)
+}
+
+// Generation returns the connection generation: it increments every time the
+// socket opens a connection, so reconnect logic can stamp its own callbacks
+// and discard those belonging to a previous connection. Zero before the
+// first Open.
+func (s *socketWithoutUpgrade) Generation() uint64 {
+	return s.generation.Load()
+}
+
+// PingInterval returns the heartbeat interval the server chose during the
+// handshake, zero before the handshake completes.
+func (s *socketWithoutUpgrade) PingInterval() time.Duration {
+	return time.Duration(s.pingInterval.Load())
+}
+
+// PingTimeout returns the heartbeat timeout the server chose during the
+// handshake, zero before the handshake completes.
+func (s *socketWithoutUpgrade) PingTimeout() time.Duration {
+	return time.Duration(s.pingTimeout.Load())
+}
+
+// Handshake returns a copy of the handshake data the server sent, nil while
+// no handshake has completed yet. A reconnect's handshake replaces the
+// previous one.
+func (s *socketWithoutUpgrade) Handshake() *HandshakeData {
+	stored := s.handshake.Load()
+	if stored == nil {
+		return nil
+	}
+
+	data := *stored
+	data.Upgrades = append([]string(nil), stored.Upgrades...)
+	return &data
+}
+
+func (s *socketWithoutUpgrade) Opts() SocketOptionsInterface {
+	return s.opts
+}
+
+func (s *socketWithoutUpgrade) Transports() *types.Set[string] {
+	return s.transports
+}
+
+func (s *socketWithoutUpgrade) Transport() Transport {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.transport
+}
+
+// TransportName returns the active transport's name ("polling", "websocket",
+// "webtransport"), or the empty string before any transport exists - the
+// connection-quality indicator without nil-checking Transport(). Changes are
+// announced by the "transportChange" event.
+func (s *socketWithoutUpgrade) TransportName() string {
+	if transport := s.Transport(); transport != nil {
+		return transport.Name()
+	}
+	return ""
+}
+
+func (s *socketWithoutUpgrade) ReadyState() SocketState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.readyState
+}
+
+func (s *socketWithoutUpgrade) setReadyState(state SocketState) {
+	// stateMu serializes the store with its notification, so transitions
+	// racing from different goroutines reach the subscribers in the order
+	// they actually happened.
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	s.mu.Lock()
+	old := s.readyState
+	s.readyState = state
+	s.mu.Unlock()
+
+	if old == state {
+		return
+	}
+
+	for _, handler := range s.stateHandlers {
+		handler(old, state)
+	}
+}
+
+// OnStateChange registers fn to be called after every readyState transition
+// with the previous and the new state. fn never fires with old == new; it
+// runs synchronously on the goroutine driving the transition and must not
+// block.
+func (s *socketWithoutUpgrade) OnStateChange(fn func(old SocketState, new SocketState)) {
+	if fn == nil {
+		return
+	}
+
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+
+	s.stateHandlers = append(s.stateHandlers, fn)
+}
+
+// WriteBuffer returns the queued packets.
+//
+// Deprecated: the returned slice is the live buffer; mutating it races with
+// Flush. Use WriteBufferLen to observe queue depth.
+func (s *socketWithoutUpgrade) WriteBuffer() []*packet.Packet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.writeBuffer
+}
+
+// WriteBufferLen returns how many packets are currently queued, without
+// exposing the buffer itself - the depth check for backpressure-aware
+// producers. Safe to call concurrently with Flush.
+func (s *socketWithoutUpgrade) WriteBufferLen() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.writeBuffer)
+}
+
+// Emit notifies the OnAny wildcard listeners before forwarding to the
+// embedded emitter, so they observe every event - internal ones included -
+// without touching per-event listener semantics.
+func (s *socketWithoutUpgrade) Emit(evt events.EventName, args ...any) {
+	s.wildcards.dispatch(evt, args...)
+	s.EventEmitter.Emit(evt, args...)
+}
+
+// OnAny registers fn to run for every event this socket emits - the debugging
+// shortcut when the flow across a dozen events is the question. Listeners run
+// synchronously on the emitting goroutine, before the event's own listeners.
+func (s *socketWithoutUpgrade) OnAny(fn AnyListener) {
+	s.wildcards.add(fn)
+}
+
+// OffAny removes a wildcard listener registered with OnAny, comparing by
+// function identity; nil removes them all. Reports whether anything was
+// removed.
+func (s *socketWithoutUpgrade) OffAny(fn AnyListener) bool {
+	return s.wildcards.remove(fn)
+}
+
+func (s *socketWithoutUpgrade) Upgrading() bool {
+	return s.upgrading.Load()
+}
+
+func (s *socketWithoutUpgrade) SetUpgrading(upgrading bool) {
+	s.upgrading.Store(upgrading)
+}
+
+// Stats returns the cumulative wire-level byte accounting of this socket,
+// one entry per transport used so far.
+func (s *socketWithoutUpgrade) Stats() []TransportStats {
+	totals := map[string]TransportStats{}
+
+	s.statsMu.Lock()
+	for name, stat := range s.pastStats {
+		totals[name] = stat
+	}
+	s.statsMu.Unlock()
+
+	if transport := s.Transport(); transport != nil {
+		stat := transport.Stats()
+		total := totals[stat.Transport]
+		total.Transport = stat.Transport
+		total.add(stat)
+		totals[stat.Transport] = total
+	}
+
+	stats := make([]TransportStats, 0, len(totals))
+	for _, stat := range totals {
+		stats = append(stats, stat)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Transport < stats[j].Transport })
+
+	return stats
+}
+
+// foldStats moves a retiring transport's counters into the socket totals.
+func (s *socketWithoutUpgrade) foldStats(transport Transport) {
+	stat := transport.Stats()
+
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	total := s.pastStats[stat.Transport]
+	total.Transport = stat.Transport
+	total.add(stat)
+	s.pastStats[stat.Transport] = total
+}
+
+func (s *socketWithoutUpgrade) PriorWebsocketSuccess() bool {
+	return priorWebsocketSuccess.Load()
+}
+
+func (s *socketWithoutUpgrade) SetPriorWebsocketSuccess(success bool) {
+	priorWebsocketSuccess.Store(success)
+}
+
+// Open starts the connection on the first configured transport.
+func (s *socketWithoutUpgrade) Open() SocketWithoutUpgrade {
+	// The set carries no ordering; try the canonical priority order.
+	transportName := ""
+	for _, name := range []string{"polling", "websocket", "webtransport"} {
+		if s.transports.Has(name) {
+			transportName = name
+			break
+		}
+	}
+
+	if transportName == "" {
+		s.Emit(EventError, NewError("No transports available", nil, nil))
+		return s
+	}
+
+	// With RememberUpgrade, a connection that previously made it onto
+	// websocket skips the polling bootstrap and dials websocket directly; a
+	// failure falls back to the normal ordering (see OnClose).
+	if s.opts.RememberUpgrade() && s.PriorWebsocketSuccess() && s.transports.Has("websocket") {
+		client_socket_log.Debug("remembering upgrade - starting on websocket")
+		transportName = "websocket"
+		s.wsShortcut.Store(true)
+	}
+
+	// The application gets the final say via SelectInitialTransport; a name
+	// outside the configured set keeps the default.
+	if selector := s.opts.SelectInitialTransport(); selector != nil {
+		picked := selector(s.transports.Keys())
+		if picked != "" && s.transports.Has(picked) {
+			client_socket_log.Debug(`initial transport "%s" picked by application`, picked)
+			transportName = picked
+		} else if picked != "" {
+			client_socket_log.Debug(`ignoring initial transport "%s" - not in the configured set`, picked)
+		}
+		s.wsShortcut.Store(s.wsShortcut.Load() && transportName == "websocket")
+	}
+
+	// A transport flagged by repeated ping timeouts is avoided whenever
+	// polling can take its place; see DowngradeAfterPingTimeouts.
+	if s.TransportProblematic(transportName) && s.transports.Has("polling") {
+		client_socket_log.Debug(`transport "%s" marked problematic - starting on polling`, transportName)
+		transportName = "polling"
+		s.wsShortcut.Store(false)
+	}
+
+	// A reconnect reuses this socket after OnClose closed done; hand the
+	// new attempt a fresh channel and re-arm the context watcher that
+	// exited with the old one, so cancellation, CloseContext and blocking
+	// senders keep working across reconnects.
+	s.doneMu.Lock()
+	reopened := false
+	select {
+	case <-s.done:
+		s.done = make(chan struct{})
+		reopened = true
+	default:
+	}
+	s.doneMu.Unlock()
+	if reopened && s.ctx != nil {
+		s.watchContext()
+	}
+
+	s.generation.Add(1)
+	s.pathMu.Lock()
+	s.connectionPath = nil
+	s.pathMu.Unlock()
+
+	s.timingsMu.Lock()
+	s.timings = ConnectTimings{}
+	s.dialStartAt = time.Now()
+	s.transportOpenAt = time.Time{}
+	s.openAt = time.Time{}
+	s.timingsMu.Unlock()
+
+	s.setReadyState(SocketStateOpening)
+
+	// A server accepting the connection but never completing the handshake
+	// would otherwise leave the socket opening forever; with OpenTimeout set
+	// the wait for "open" is bounded.
+	if timeout := s.opts.OpenTimeout(); timeout > 0 {
+		gen := s.generation.Load()
+		s.openTimerMu.Lock()
+		utils.ClearTimeout(s.openTimer)
+		s.openTimer = utils.SetTimeout(func() {
+			if s.generation.Load() != gen || s.ReadyState() != SocketStateOpening {
+				return
+			}
+			client_socket_log.Debug("connection did not open within %v", timeout)
+			err := &TimeoutError{Op: "open", After: timeout}
+			s.Emit(EventError, NewError("open timeout", err, nil))
+			s.proto.OnClose("open timeout", err)
+		}, timeout)
+		s.openTimerMu.Unlock()
+	}
+
+	transport, err := s.proto.CreateTransport(transportName)
+	if err != nil {
+		client_socket_log.Debug(`error while creating transport "%s": %v`, transportName, err)
+		s.Emit(EventError, NewError("transport error", err, nil))
+		return s
+	}
+
+	s.proto.SetTransport(transport)
+	transport.Open()
+
+	return s
+}
+
+// CreateTransport builds a named transport carrying the handshake query.
+func (s *socketWithoutUpgrade) CreateTransport(name string) (Transport, error) {
+	client_socket_log.Debug(`creating transport "%s"`, name)
+
+	constructor, ok := transports[name]
+	if !ok {
+		return nil, errors.New(`transport "` + name + `" is not supported`)
+	}
+
+	opts := DefaultSocketOptions()
+	opts.Assign(s.opts)
+
+	// A per-transport override wins over the global options - different
+	// headers for polling than for websocket, a different path, and so on.
+	if overrides := s.opts.TransportOptions(); overrides != nil {
+		if override, ok := overrides[name]; ok && override != nil {
+			client_socket_log.Debug(`applying transport options override for "%s"`, name)
+			opts.Assign(override)
+		}
+	}
+
+	query := url.Values{}
+	for key, values := range opts.Query() {
+		query[key] = values
+	}
+	query.Set("EIO", strconv.Itoa(s.opts.ProtocolVersion()))
+	query.Set("transport", name)
+	if sid := s.Id(); sid != "" {
+		query.Set("sid", sid)
+	}
+	opts.SetQuery(query)
+
+	return constructor(s.proto, opts), nil
+}
+
+// SetTransport swaps the active transport, rebinding the socket listeners.
+func (s *socketWithoutUpgrade) SetTransport(transport Transport) {
+	client_socket_log.Debug(`setting transport "%s"`, transport.Name())
+
+	if prev := s.Transport(); prev != nil {
+		client_socket_log.Debug(`clearing existing transport "%s"`, prev.Name())
+		s.foldStats(prev)
+		prev.Clear()
+	}
+
+	s.mu.Lock()
+	s.transport = transport
+	s.mu.Unlock()
+
+	s.pathMu.Lock()
+	s.connectionPath = append(s.connectionPath, transport.Name())
+	s.pathMu.Unlock()
+
+	s.Emit(EventTransportChange, transport)
+
+	s.datagramNotified.Store(false)
+
+	// Stamp the listeners with the current generation: a dead transport's
+	// late events must not reach a connection opened after it.
+	gen := s.generation.Load()
+
+	transport.On(EventOpen, func(...any) {
+		if s.generation.Load() != gen {
+			return
+		}
+		s.onTransportOpenTiming()
+	})
+	transport.On(EventDrain, func(args ...any) {
+		if s.generation.Load() != gen {
+			return
+		}
+		var err error
+		if len(args) > 0 {
+			err, _ = args[0].(error)
+		}
+		s.onDrain(err)
+	})
+	transport.On(EventPacket, func(args ...any) {
+		if s.generation.Load() != gen {
+			return
+		}
+		if len(args) > 0 {
+			if p, ok := args[0].(*packet.Packet); ok {
+				s.proto.OnPacket(p)
+			}
+		}
+	})
+	transport.On(EventNoop, func(...any) {
+		if s.generation.Load() != gen {
+			return
+		}
+		s.countPacket(packet.NOOP)
+		s.Emit(EventNoop)
+	})
+	transport.On(EventTransportMismatch, func(args ...any) {
+		if s.generation.Load() != gen {
+			return
+		}
+		s.Emit(EventTransportMismatch, args...)
+	})
+	transport.On(EventError, func(args ...any) {
+		if s.generation.Load() != gen {
+			return
+		}
+		if len(args) > 0 {
+			if err, ok := args[0].(error); ok {
+				s.proto.OnError(err)
+				return
+			}
+		}
+		s.proto.OnError(errors.New("transport error"))
+	})
+	transport.On(EventClose, func(args ...any) {
+		if s.generation.Load() != gen {
+			return
+		}
+		var details error
+		if len(args) > 0 {
+			details, _ = args[0].(error)
+		}
+		s.proto.OnClose("transport close", details)
+	})
+}
+
+// RefreshTransport rebuilds the active transport in place: a fresh transport
+// of the same type is opened with the session's sid, verified with a "probe"
+// PING/PONG round trip, and promoted via SetTransport while the old one is
+// paused and then closed - the on-demand counterpart of the upgrade probe, for
+// shedding a degraded TCP/TLS connection without losing the Engine.IO session.
+// "transportRefresh" fires with the new Transport once the swap is done; any
+// failure closes the candidate and leaves the current transport untouched.
+func (s *socketWithoutUpgrade) RefreshTransport() {
+	if SocketStateOpen != s.ReadyState() || s.Upgrading() {
+		return
+	}
+
+	current := s.Transport()
+	if current == nil {
+		return
+	}
+	name := current.Name()
+
+	client_socket_log.Debug(`refreshing transport "%s"`, name)
+
+	transport, err := s.proto.CreateTransport(name)
+	if err != nil {
+		client_socket_log.Debug(`error while creating refresh transport "%s": %v`, name, err)
+		s.Emit(EventError, NewError("refresh error", err, name))
+		return
+	}
+
+	gen := s.generation.Load()
+
+	var failed atomic.Bool
+	var cleanup func()
+
+	freezeTransport := func() {
+		if !failed.CompareAndSwap(false, true) {
+			return
+		}
+
+		cleanup()
+
+		transport.Close()
+	}
+
+	onerror := func(errs ...any) {
+		var description error
+		if len(errs) > 0 {
+			description, _ = errs[0].(error)
+		}
+
+		freezeTransport()
+
+		client_socket_log.Debug(`refresh transport "%s" failed because of error: %v`, name, description)
+		s.Emit(EventError, NewError("refresh error", description, name))
+	}
+
+	onTransportClose := func(...any) {
+		onerror(errors.New("transport closed"))
+	}
+
+	onclose := func(...any) {
+		onerror(errors.New("socket closed"))
+	}
+
+	onTransportOpen := func(...any) {
+		if failed.Load() || s.generation.Load() != gen {
+			return
+		}
+
+		client_socket_log.Debug(`refresh transport "%s" opened`, name)
+		transport.Send([]*packet.Packet{
+			{
+				Type: packet.PING,
+				Data: _types.NewStringBufferString("probe"),
+			},
+		})
+		transport.Once(EventPacket, func(msgs ...any) {
+			if failed.Load() {
+				return
+			}
+			if len(msgs) == 0 {
+				return
+			}
+			msg, ok := msgs[0].(*packet.Packet)
+			if !ok {
+				return
+			}
+
+			msgData, _ := msg.Data.(_types.BufferInterface)
+
+			if packet.PONG != msg.Type || msgData == nil || "probe" != msgData.String() {
+				client_socket_log.Debug(`refresh transport "%s" probe failed`, name)
+				onerror(errors.New("probe mismatch"))
+				return
+			}
+
+			// Block the upgrade machinery while the old transport drains; the
+			// server treats the swap exactly like an upgrade, so the UPGRADE
+			// packet completes it.
+			s.SetUpgrading(true)
+
+			old := s.Transport()
+			client_socket_log.Debug(`pausing current transport "%s" for refresh`, name)
+			old.Pause(func() {
+				if failed.Load() || SocketStateClosed == s.ReadyState() || s.generation.Load() != gen {
+					s.SetUpgrading(false)
+					return
+				}
+				client_socket_log.Debug("changing transport and sending upgrade packet")
+
+				cleanup()
+
+				// The UPGRADE packet travels through the write buffer like
+				// any other outgoing packet; see queueControlPacket for why
+				// a direct transport Send here is unsafe.
+				s.QueueControlPacket(&packet.Packet{Type: packet.UPGRADE})
+				s.proto.SetTransport(transport)
+				old.Close()
+				s.Emit(EventTransportRefresh, transport)
+				s.SetUpgrading(false)
+				s.Flush()
+			})
+		})
+	}
+
+	cleanup = func() {
+		transport.RemoveListener(EventOpen, onTransportOpen)
+		transport.RemoveListener(EventError, onerror)
+		transport.RemoveListener(EventClose, onTransportClose)
+		s.RemoveListener(EventClose, onclose)
+	}
+
+	transport.Once(EventOpen, onTransportOpen)
+	transport.Once(EventError, onerror)
+	transport.Once(EventClose, onTransportClose)
+
+	s.Once(EventClose, onclose)
+
+	transport.Open()
+}
+
+// onTransportOpenTiming closes out the dial phase of the connect timings once
+// the initial transport reports open, and arms the handshake-phase watchdog
+// when HandshakePacketTimeout asks for one - a transport that dialed fine but
+// never receives the OPEN packet is otherwise only caught by the overall
+// OpenTimeout.
+func (s *socketWithoutUpgrade) onTransportOpenTiming() {
+	now := time.Now()
+	s.timingsMu.Lock()
+	if !s.dialStartAt.IsZero() && s.transportOpenAt.IsZero() {
+		s.transportOpenAt = now
+		s.timings.Dial = now.Sub(s.dialStartAt)
+	}
+	s.timingsMu.Unlock()
+
+	if timeout := s.opts.HandshakePacketTimeout(); timeout > 0 && SocketStateOpening == s.ReadyState() {
+		gen := s.generation.Load()
+		s.handshakeTimerMu.Lock()
+		utils.ClearTimeout(s.handshakeTimer)
+		s.handshakeTimer = utils.SetTimeout(func() {
+			if s.generation.Load() != gen || s.ReadyState() != SocketStateOpening {
+				return
+			}
+			client_socket_log.Debug("no OPEN packet within %v of the transport opening", timeout)
+			err := &TimeoutError{Op: "handshake", After: timeout}
+			s.Emit(EventError, NewError("handshake timeout", err, nil))
+			s.proto.OnClose("handshake timeout", err)
+		}, timeout)
+		s.handshakeTimerMu.Unlock()
+	}
+}
+
+func (s *socketWithoutUpgrade) cancelHandshakeTimer() {
+	s.handshakeTimerMu.Lock()
+	defer s.handshakeTimerMu.Unlock()
+
+	utils.ClearTimeout(s.handshakeTimer)
+	s.handshakeTimer = nil
+}
+
+// ConnectTimings returns the phase durations of the current connection
+// attempt: dial, handshake wait and - when one completed - the upgrade. The
+// same value rides the "open" event.
+func (s *socketWithoutUpgrade) ConnectTimings() ConnectTimings {
+	s.timingsMu.Lock()
+	defer s.timingsMu.Unlock()
+
+	return s.timings
+}
+
+// OnOpen is called when the connection is established.
+func (s *socketWithoutUpgrade) OnOpen() {
+	client_socket_log.Debug("socket open")
+
+	// On a websocket-first connection the handshake body could not ride a
+	// POST; it goes out as the very first MESSAGE instead, before the
+	// application hears "open". Polling delivered it on the handshake POST.
+	if provider := s.opts.HandshakeBodyProvider(); provider != nil {
+		if transport := s.Transport(); transport != nil && transport.Name() != "polling" {
+			if reader, _ := provider(); reader != nil {
+				buffer := _types.NewBytesBuffer(nil)
+				if _, err := buffer.ReadFrom(reader); err != nil {
+					s.proto.OnError(&HandshakeError{Cause: err})
+					return
+				}
+				client_socket_log.Debug("sending handshake body as first message")
+				transport.Send([]*packet.Packet{{Type: packet.MESSAGE, Data: buffer}})
+			}
+		}
+	}
+
+	s.cancelOpenTimer()
+	s.wsShortcut.Store(false)
+
+	s.timingsMu.Lock()
+	s.openAt = time.Now()
+	s.timingsMu.Unlock()
+
+	s.setReadyState(SocketStateOpen)
+	s.reconnectAttempts.Store(0)
+	s.SetPriorWebsocketSuccess("websocket" == s.Transport().Name())
+	s.Emit(EventOpen, s.ConnectTimings())
+	s.Flush()
+}
+
+// OnHandshake is called with the handshake data decoded from the server's
+// OPEN packet.
+func (s *socketWithoutUpgrade) OnHandshake(data *HandshakeData) {
+	now := time.Now()
+	s.timingsMu.Lock()
+	if !s.transportOpenAt.IsZero() {
+		s.timings.Handshake = now.Sub(s.transportOpenAt)
+	} else if !s.dialStartAt.IsZero() {
+		// Polling folds dial and handshake into the first request.
+		s.timings.Handshake = now.Sub(s.dialStartAt)
+	}
+	s.timingsMu.Unlock()
+	s.cancelHandshakeTimer()
+
+	s.id.Store(data.Sid)
+
+	snapshot := *data
+	snapshot.Upgrades = append([]string(nil), data.Upgrades...)
+	s.handshake.Store(&snapshot)
+	s.Emit(EventHandshake, &snapshot)
+
+	if transport := s.Transport(); transport != nil {
+		transport.Query().Set("sid", data.Sid)
+	}
+
+	s.pingInterval.Store(int64(time.Duration(data.PingInterval) * time.Millisecond))
+	s.pingTimeout.Store(int64(time.Duration(data.PingTimeout) * time.Millisecond))
+	s.maxPayload.Store(data.MaxPayload)
+
+	// The payload codec only becomes active when the server acknowledges it;
+	// otherwise payloads pass through untouched.
+	codec := s.opts.PayloadCodec()
+	s.codecActive.Store(codec != nil && data.Codec == codec.Name())
+
+	s.proto.OnOpen()
+
+	// In case open handler closes socket.
+	if SocketStateClosed == s.ReadyState() {
+		return
+	}
+
+	// Protocol v3 inverts the heartbeat: the client pings and the server
+	// pongs, so instead of the passive watchdog the socket drives the cycle.
+	if s.opts.ProtocolVersion() == 3 {
+		s._schedulePing()
+	} else {
+		s.resetPingTimeout()
+	}
+}
+
+// _schedulePing arms the next client-initiated heartbeat of protocol v3: a
+// PING goes out after pingInterval, then a watchdog closes the socket unless
+// the server's PONG lands within pingTimeout. OnPacket's PONG case reschedules
+// the cycle. Protocol v4 never gets here - the server pings there and
+// resetPingTimeout is the whole story.
+func (s *socketWithoutUpgrade) _schedulePing() {
+	s.v3PingTimerMu.Lock()
+	defer s.v3PingTimerMu.Unlock()
+
+	gen := s.generation.Load()
+	utils.ClearTimeout(s.v3PingTimer)
+	s.v3PingTimer = utils.SetTimeout(func() {
+		if s.generation.Load() != gen || SocketStateOpen != s.ReadyState() {
+			return
+		}
+
+		s.Emit(EventPing)
+		s.sendPacket(packet.PING, nil, nil, func() {
+			s.pongSentAt.Store(time.Now())
+		})
+
+		// Arm the pong watchdog; the PONG case clears it by rescheduling.
+		s.timerMu.Lock()
+		utils.ClearTimeout(s.pingTimeoutTimer)
+		s.pingTimeoutTimer = utils.SetTimeout(func() {
+			if s.generation.Load() != gen {
+				return
+			}
+			s.proto.OnClose("ping timeout", nil)
+		}, time.Duration(s.pingTimeout.Load()))
+		s.timerMu.Unlock()
+	}, time.Duration(s.pingInterval.Load()))
+}
+
+// cancelV3PingTimer stops a pending v3 heartbeat ping, if any.
+func (s *socketWithoutUpgrade) cancelV3PingTimer() {
+	s.v3PingTimerMu.Lock()
+	defer s.v3PingTimerMu.Unlock()
+
+	utils.ClearTimeout(s.v3PingTimer)
+	s.v3PingTimer = nil
+}
+
+// resetPingTimeout arms the heartbeat watchdog for one ping cycle.
+func (s *socketWithoutUpgrade) resetPingTimeout() {
+	delay := time.Duration(s.pingInterval.Load() + s.pingTimeout.Load())
+
+	// A touch of jitter keeps a fleet of clients sharing one pingInterval
+	// from all declaring a hiccuping server dead at the same instant. Only
+	// the local watchdog moves; the protocol timings are untouched.
+	if jitter := s.opts.PingTimeoutJitter(); jitter > 0 {
+		delay += time.Duration(float64(delay) * jitter * rand.Float64())
+	}
+
+	s.pingTimeoutTime.Store(time.Now().Add(delay).UnixNano())
+
+	// The watchdog itself waits out the grace window too, so the timer and
+	// the HasPingExpired check agree on when a connection is dead.
+	delay += s.opts.PingTimeoutGrace()
+
+	s.timerMu.Lock()
+	defer s.timerMu.Unlock()
+
+	gen := s.generation.Load()
+	utils.ClearTimeout(s.pingTimeoutTimer)
+	s.pingTimeoutTimer = utils.SetTimeout(func() {
+		if s.generation.Load() != gen {
+			return
+		}
+		s.proto.OnClose("ping timeout", nil)
+	}, delay)
+}
+
+// countPacket tallies one packet of the given type; see PacketCounts.
+func (s *socketWithoutUpgrade) countPacket(t packet.Type) {
+	s.packetCountsMu.Lock()
+	s.packetCounts[t]++
+	s.packetCountsMu.Unlock()
+}
+
+// PacketCounts returns a snapshot of how many packets of each type have
+// crossed this socket, received and sent combined - a quick way to confirm
+// that PINGs are arriving at the negotiated interval and PONGs are going
+// out. The counts accumulate across reconnects.
+func (s *socketWithoutUpgrade) PacketCounts() map[packet.Type]uint64 {
+	s.packetCountsMu.Lock()
+	defer s.packetCountsMu.Unlock()
+
+	counts := make(map[packet.Type]uint64, len(s.packetCounts))
+	for t, n := range s.packetCounts {
+		counts[t] = n
+	}
+	return counts
+}
+
+// sampleHeartbeatRTT derives a round-trip estimate from the heartbeat cycle,
+// without extra traffic: the server schedules its next PING pingInterval
+// after it received our PONG, so the gap between our confirmed PONG write and
+// that PING runs one network round trip over the interval. A sample is
+// skipped when the arithmetic comes out negative (a throttled timer on either
+// side, an interval change mid-cycle).
+func (s *socketWithoutUpgrade) sampleHeartbeatRTT() {
+	sentAt, _ := s.pongSentAt.Load().(time.Time)
+	if sentAt.IsZero() {
+		return
+	}
+	s.pongSentAt.Store(time.Time{})
+
+	interval := time.Duration(s.pingInterval.Load())
+	if interval <= 0 {
+		return
+	}
+
+	rtt := time.Since(sentAt) - interval
+	if rtt < 0 {
+		return
+	}
+
+	s.recordRTTSample(rtt)
+}
+
+// recordRTTSample folds one round-trip sample into LastRTT/AvgRTT and
+// announces it on the heartbeat event.
+func (s *socketWithoutUpgrade) recordRTTSample(rtt time.Duration) {
+	s.lastRTT.Store(int64(rtt))
+
+	// TCP-style smoothing: seven parts history, one part fresh sample.
+	avg := s.avgRTT.Load()
+	if avg == 0 {
+		avg = int64(rtt)
+	} else {
+		avg = (avg*7 + int64(rtt)) / 8
+	}
+	s.avgRTT.Store(avg)
+
+	client_socket_log.Debug("heartbeat rtt sample %v (avg %v)", rtt, time.Duration(avg))
+	s.Emit(EventHeartbeat, rtt)
+}
+
+// LastRTT returns the most recent heartbeat round-trip estimate, zero before
+// the second heartbeat cycle produced one; see sampleHeartbeatRTT for how it
+// is derived.
+func (s *socketWithoutUpgrade) LastRTT() time.Duration {
+	return time.Duration(s.lastRTT.Load())
+}
+
+// AvgRTT returns the smoothed heartbeat round-trip estimate (an exponentially
+// weighted average of the LastRTT samples), zero before the first sample.
+func (s *socketWithoutUpgrade) AvgRTT() time.Duration {
+	return time.Duration(s.avgRTT.Load())
+}
+
+// HasPingExpired checks the heartbeat deadline, closing the socket when it
+// has passed (e.g. after the process was suspended and timers misfired). A
+// configured PingTimeoutGrace buys a late heartbeat that much extra time -
+// laptops waking from sleep blow the deadline routinely without the
+// connection being dead - and a "ping_late" event flags checks landing inside
+// the grace window.
+func (s *socketWithoutUpgrade) HasPingExpired() bool {
+	nanos := s.pingTimeoutTime.Load()
+	if nanos == 0 {
+		return false
+	}
+	deadline := time.Unix(0, nanos)
+
+	now := time.Now()
+	if !now.After(deadline) {
+		return false
+	}
+
+	if grace := s.opts.PingTimeoutGrace(); grace > 0 && !now.After(deadline.Add(grace)) {
+		late := now.Sub(deadline)
+		client_socket_log.Debug("heartbeat %v late - within the %v grace window", late, grace)
+		s.Emit(EventPingLate, late)
+		return false
+	}
+
+	client_socket_log.Debug("throttled timer detected, scheduling connection close")
+	s.pingTimeoutTime.Store(0)
+	s.proto.OnClose("ping timeout", nil)
+	return true
+}
+
+// OnPacket handles a packet received from the transport.
+func (s *socketWithoutUpgrade) OnPacket(data *packet.Packet) {
+	if state := s.ReadyState(); state == SocketStateOpening || state == SocketStateOpen || state == SocketStateClosing {
+		client_socket_log.Debug(`socket receive: type "%s"`, data.Type)
+
+		s.countPacket(data.Type)
+		s.Emit(EventPacket, data)
+
+		// Socket is live - any packet counts.
+		s.Emit(EventHeartbeat)
+
+		// Servers sometimes flag application-level errors in an ordinary
+		// packet before closing; a configured matcher turns those into
+		// "error" events (and, on request, a close) instead of every app
+		// parsing every message itself. Matched packets do not surface again
+		// as messages.
+		if matcher := s.opts.ErrorPacketMatcher(); matcher != nil {
+			if err := matcher(data); err != nil {
+				client_socket_log.Debug("error packet matched: %v", err)
+				s.Emit(EventError, NewError("server error", err, data))
+				if s.opts.CloseOnErrorPacket() {
+					s.proto.OnClose("server error", err)
+				}
+				return
+			}
+		}
+
+		switch data.Type {
+		case packet.OPEN:
+			raw, ok := data.Data.(_types.BufferInterface)
+			if !ok || raw == nil {
+				s.proto.OnError(errors.New("handshake missing data"))
+				return
+			}
+			// The raw payload goes out before any parsing so a listener sees
+			// exactly what the server sent, parse failure or not.
+			s.Emit(EventRawHandshake, append([]byte(nil), raw.Bytes()...))
+
+			var handshake *HandshakeData
+			if err := json.Unmarshal(raw.Bytes(), &handshake); err != nil {
+				s.proto.OnError(err)
+				return
+			}
+			s.proto.OnHandshake(handshake)
+
+		case packet.PING:
+			s.sampleHeartbeatRTT()
+			s.resetPingTimeout()
+			pingArrived := time.Now()
+			pingPayload := data.Data
+			s.Emit(EventPing, pingPayload)
+			s.sendPacket(packet.PONG, nil, nil, func() {
+				s.pongSentAt.Store(time.Now())
+				// The PONG is confirmed written; report how long the reply
+				// took from the moment the PING arrived.
+				s.Emit(EventPong, pingPayload, time.Since(pingArrived))
+			})
+
+		case packet.PONG:
+			// Only protocol v3 expects inbound PONGs; the server answering
+			// the ping sent by _schedulePing. Clear the pong watchdog by
+			// arming the next cycle.
+			if s.opts.ProtocolVersion() == 3 {
+				// Unlike the v4 heuristic, the PING-to-PONG gap here is one
+				// network round trip as-is; no interval subtraction.
+				delay := time.Duration(0)
+				if sentAt, ok := s.pongSentAt.Load().(time.Time); ok && !sentAt.IsZero() {
+					s.pongSentAt.Store(time.Time{})
+					delay = time.Since(sentAt)
+					s.recordRTTSample(delay)
+				}
+				s.Emit(EventPong, data.Data, delay)
+				s._schedulePing()
+			}
+
+		case packet.ERROR:
+			s.proto.OnError(errors.New("server error"))
+
+		case packet.NOOP:
+			s.Emit(EventNoop)
+
+		case packet.MESSAGE:
+			payload := data.Data
+			if s.codecActive.Load() {
+				if buffer, ok := data.Data.(_types.BufferInterface); ok {
+					decoded, err := decodeCodecPayload(s.opts.PayloadCodec(), buffer)
+					if err != nil {
+						s.proto.OnError(err)
+						return
+					}
+					payload = decoded
+				}
+			}
+			s.Emit(EventData, payload)
+			s.Emit(EventMessage, payload)
+		}
+	} else {
+		client_socket_log.Debug(`packet received with socket readyState "%s"`, s.ReadyState())
+	}
+}
+
+// onDrain is called when the transport has settled the flushed batch: err is
+// nil when the write was confirmed, the write error otherwise. Either way the
+// batch leaves the buffer - a failed batch is tracked through the
+// transport's Undelivered packets, not retried here - and its callbacks fire
+// with the outcome, before the "drain" event announces the batch as settled.
+func (s *socketWithoutUpgrade) onDrain(err error) {
+	s.mu.Lock()
+	var freed int64
+	for _, pkt := range s.writeBuffer[:s.prevBufferLen] {
+		if buf, ok := pkt.Data.(_types.BufferInterface); ok && buf != nil {
+			freed += int64(buf.Len())
+		}
+	}
+	settled := append([]func(error){}, s.writeCallbacks[:s.prevBufferLen]...)
+	s.writeBuffer = s.writeBuffer[s.prevBufferLen:]
+	s.writeCallbacks = s.writeCallbacks[s.prevBufferLen:]
+	s.bufferedBytes -= freed
+	s.prevBufferLen = 0
+	remaining := len(s.writeBuffer)
+	remainingBytes := s.bufferedBytes
+	if s.bufferRoom != nil {
+		close(s.bufferRoom)
+		s.bufferRoom = nil
+	}
+	s.mu.Unlock()
+
+	for _, cb := range settled {
+		if cb != nil {
+			s.invokeWriteCallback(cb, err)
+		}
+	}
+
+	if remaining > 0 {
+		s.Flush()
+	}
+	if s.belowLowWater(remaining, remainingBytes) {
+		s.Emit(EventDrain)
+	}
+}
+
+// Flush hands the buffered packets to the transport when possible.
+func (s *socketWithoutUpgrade) Flush() {
+	s.mu.Lock()
+	transport := s.transport
+
+	// Transports with per-packet framing cannot split an oversized packet
+	// the way polling splits its batches; reject it client-side before the
+	// server kills the connection over it. Only safe while no batch is in
+	// flight - the callbacks run parallel to the buffer.
+	var rejectedCbs []func(error)
+	var rejectedErrs []error
+	if transport != nil && transport.Name() != "polling" && s.prevBufferLen == 0 && len(s.writeBuffer) > 0 {
+		maxPayload := int64(s.opts.MaxPayload())
+		if maxPayload <= 0 {
+			maxPayload = s.maxPayload.Load()
+		}
+		if maxPayload > 0 {
+			rejectedCbs, rejectedErrs = s.rejectOversized(maxPayload)
+		}
+	}
+
+	shouldFlush := SocketStateClosed != s.readyState &&
+		transport != nil && transport.Writable() &&
+		!s.upgrading.Load() &&
+		len(s.writeBuffer) > 0 &&
+		s.prevBufferLen == 0
+	var packets []*packet.Packet
+	if shouldFlush {
+		packets = s.writablePackets(transport)
+		s.prevBufferLen = len(packets)
+	}
+	s.mu.Unlock()
+
+	for i, cb := range rejectedCbs {
+		err := rejectedErrs[i]
+		client_socket_log.Debug("packet rejected: %v", err)
+		s.Emit(EventError, NewError("payload too large", err, nil))
+		if cb != nil {
+			s.invokeWriteCallback(cb, err)
+		}
+	}
+
+	if shouldFlush {
+		client_socket_log.Debug("flushing %d packets in socket", len(packets))
+		// Summarize and record the batch before the transport takes it: its
+		// writer goroutine starts consuming the packet buffers immediately,
+		// and reading them here afterwards would race with the encoder.
+		batch := flushedBatch(packets)
+		if rec := s.opts.Recorder(); rec != nil {
+			for _, pkt := range packets {
+				rec.RecordPacket(RecordDirectionOut, pkt)
+			}
+		}
+		transport.Send(packets)
+		s.Emit(EventFlush, batch, len(packets))
+	}
+}
+
+// writablePackets returns the prefix of the write buffer that fits into one
+// flush. Transports with per-packet framing take the whole buffer; polling
+// batches everything into a single POST, so the batch is cut to the
+// effective max payload (the MaxPayload option, or the handshake value when
+// unset) and the rest goes out with the next flush. The caller holds s.mu.
+func (s *socketWithoutUpgrade) writablePackets(transport Transport) []*packet.Packet {
+	if transport.Name() != "polling" || len(s.writeBuffer) == 1 {
+		return append([]*packet.Packet(nil), s.writeBuffer...)
+	}
+
+	maxPayload := int64(s.opts.MaxPayload())
+	if maxPayload <= 0 {
+		maxPayload = s.maxPayload.Load()
+	}
+	if maxPayload <= 0 {
+		return append([]*packet.Packet(nil), s.writeBuffer...)
+	}
+
+	payloadSize := int64(0)
+	for i, pkt := range s.writeBuffer {
+		payloadSize += packetWireSize(pkt)
+		// The first packet always goes through, oversized or not; the
+		// server's own maxPayload handling has the final word there.
+		if i > 0 && payloadSize > maxPayload {
+			client_socket_log.Debug("flush cut to %d of %d packets by max payload %d", i, len(s.writeBuffer), maxPayload)
+			return append([]*packet.Packet(nil), s.writeBuffer[:i]...)
+		}
+	}
+
+	return append([]*packet.Packet(nil), s.writeBuffer...)
+}
+
+// rejectOversized removes every queued packet whose framed size exceeds
+// limit, returning the dropped callbacks paired with their
+// *PayloadTooLargeError values. The caller holds s.mu and settles the
+// callbacks after unlocking.
+func (s *socketWithoutUpgrade) rejectOversized(limit int64) (cbs []func(error), errs []error) {
+	keptPackets := s.writeBuffer[:0]
+	keptCbs := s.writeCallbacks[:0]
+
+	for i, pkt := range s.writeBuffer {
+		size := packetFrameSize(pkt)
+		if size > limit {
+			cbs = append(cbs, s.writeCallbacks[i])
+			errs = append(errs, &PayloadTooLargeError{Size: size, Limit: limit})
+			if buf, ok := pkt.Data.(_types.BufferInterface); ok && buf != nil {
+				s.bufferedBytes -= int64(buf.Len())
+			}
+			continue
+		}
+		keptPackets = append(keptPackets, pkt)
+		keptCbs = append(keptCbs, s.writeCallbacks[i])
+	}
+
+	s.writeBuffer = keptPackets
+	s.writeCallbacks = keptCbs
+
+	return cbs, errs
+}
+
+// packetFrameSize approximates the bytes pkt occupies as a single framed
+// message (websocket, webtransport): the type byte plus the string data, or
+// the raw binary data which travels headerless in protocol v4.
+func packetFrameSize(pkt *packet.Packet) int64 {
+	if pkt == nil || pkt.Data == nil {
+		return 1
+	}
+	if buf, ok := pkt.Data.(_types.BufferInterface); ok {
+		if _, isString := buf.(*_types.StringBuffer); isString {
+			return 1 + int64(buf.Len())
+		}
+		return int64(buf.Len())
+	}
+	return 1
+}
+
+// packetWireSize approximates the bytes pkt occupies inside a polling
+// payload: the type or base64 marker, the (possibly base64-expanded) data
+// and the record separator joining packets.
+func packetWireSize(pkt *packet.Packet) int64 {
+	size := int64(2)
+	if pkt == nil || pkt.Data == nil {
+		return size
+	}
+	if buf, ok := pkt.Data.(_types.BufferInterface); ok {
+		if _, isString := buf.(*_types.StringBuffer); isString {
+			return size + int64(buf.Len())
+		}
+		return size + (int64(buf.Len())+2)/3*4
+	}
+	return size
+}
+
+// flushedBatch summarizes the packets of one flush as type/payload-size
+// pairs, the shape the "flush" event carries.
+func flushedBatch(packets []*packet.Packet) []FlushedPacket {
+	batch := make([]FlushedPacket, len(packets))
+	for i, pkt := range packets {
+		batch[i].Type = pkt.Type
+		if buf, ok := pkt.Data.(_types.BufferInterface); ok && buf != nil {
+			batch[i].Size = int64(buf.Len())
+		}
+	}
+	return batch
+}
+
+// Write queues a MESSAGE packet; fn is invoked once the transport confirmed
+// the write, i.e. the bytes left this process - after the websocket frame
+// went out, after the polling POST succeeded - never on mere enqueueing.
+// Callbacks of a batch run before the socket's "drain" event for that batch,
+// so a drain listener observes every packet of the batch as sent. fn is not
+// invoked when the write fails; see WriteWithResult for the errorful variant.
+func (s *socketWithoutUpgrade) Write(msg io.Reader, options *packet.Options, fn func()) SocketWithoutUpgrade {
+	s.sendPacket(packet.MESSAGE, msg, options, fn)
+	return s
+}
+
+// Send is an alias of Write.
+func (s *socketWithoutUpgrade) Send(msg io.Reader, options *packet.Options, fn func()) SocketWithoutUpgrade {
+	s.sendPacket(packet.MESSAGE, msg, options, fn)
+	return s
+}
+
+// SendVolatile queues msg only when it can go out right away: socket open,
+// transport writable and no upgrade in progress. Otherwise the packet is
+// dropped and counted (see DroppedPackets) instead of buffered -
+// telemetry-style traffic prefers loss over backlog. Note that polling
+// toggles writability with every POST, so volatile sends issued while a POST
+// is in flight are dropped by design.
+func (s *socketWithoutUpgrade) SendVolatile(msg io.Reader, options *packet.Options, fn func()) SocketWithoutUpgrade {
+	transport := s.Transport()
+	if SocketStateOpen != s.ReadyState() || transport == nil || !transport.Writable() || s.upgrading.Load() {
+		s.droppedPackets.Add(1)
+		client_socket_log.Debug("volatile send dropped - transport not ready")
+		return s
+	}
+
+	s.sendPacket(packet.MESSAGE, msg, options, fn)
+	return s
+}
+
+// DroppedPackets returns how many volatile sends have been dropped because
+// the transport was not ready to take them.
+func (s *socketWithoutUpgrade) DroppedPackets() uint64 {
+	return s.droppedPackets.Load()
+}
+
+// TryWrite is like Write but reports queuing failures: it returns
+// ErrSocketClosed when the socket is closing or closed instead of silently
+// dropping the message.
+func (s *socketWithoutUpgrade) TryWrite(msg io.Reader, options *packet.Options, fn func()) error {
+	return s.trySendPacket(packet.MESSAGE, msg, options, fn)
+}
+
+// TrySend is an alias of TryWrite.
+func (s *socketWithoutUpgrade) TrySend(msg io.Reader, options *packet.Options, fn func()) error {
+	return s.trySendPacket(packet.MESSAGE, msg, options, fn)
+}
+
+// WriteWithResult queues a MESSAGE packet like Write, but fn is invoked with
+// the outcome of the transport-level write: nil once the bytes left this
+// process, the write error when the batch failed (including the close error
+// when the socket goes down with the packet still queued). The reliable
+// "sent" signal for request/response layers: exactly one invocation per
+// packet, after transmission settled, before the batch's "drain" event.
+func (s *socketWithoutUpgrade) WriteWithResult(msg io.Reader, options *packet.Options, fn func(error)) SocketWithoutUpgrade {
+	s.queuePacket(packet.MESSAGE, msg, options, fn)
+	return s
+}
+
+// SendWithResult is an alias of WriteWithResult.
+func (s *socketWithoutUpgrade) SendWithResult(msg io.Reader, options *packet.Options, fn func(error)) SocketWithoutUpgrade {
+	s.queuePacket(packet.MESSAGE, msg, options, fn)
+	return s
+}
+
+// sendArgs pulls the optional packet options and write callback out of the
+// variadic tail accepted by the convenience send methods. Arguments may
+// appear in any order; unknown types are ignored. A func() fires only on a
+// confirmed write, a func(error) additionally receives write failures.
+func sendArgs(args []any) (options *packet.Options, cb func(error)) {
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case *packet.Options:
+			options = v
+		case func():
+			cb = successCallback(v)
+		case func(error):
+			cb = v
+		}
+	}
+	return options, cb
+}
+
+// SendString sends msg as a text message. The variadic tail may carry a
+// *packet.Options and/or a func() or func(error) write callback.
+func (s *socketWithoutUpgrade) SendString(msg string, args ...any) SocketWithoutUpgrade {
+	options, cb := sendArgs(args)
+	s.queuePacket(packet.MESSAGE, _types.NewStringBufferString(msg), options, cb)
+	return s
+}
+
+// SendBytes sends msg as a binary message, base64-encoded on transports that
+// cannot carry raw binary (such as polling with ForceBase64). The variadic
+// tail may carry a *packet.Options and/or a func() or func(error) write
+// callback.
+func (s *socketWithoutUpgrade) SendBytes(msg []byte, args ...any) SocketWithoutUpgrade {
+	options, cb := sendArgs(args)
+	s.queuePacket(packet.MESSAGE, _types.NewBytesBuffer(msg), options, cb)
+	return s
+}
+
+// SendReader drains msg and sends it as a binary message. The variadic tail
+// may carry a *packet.Options and/or a func() or func(error) write callback.
+func (s *socketWithoutUpgrade) SendReader(msg io.Reader, args ...any) SocketWithoutUpgrade {
+	options, cb := sendArgs(args)
+	s.queuePacket(packet.MESSAGE, msg, options, cb)
+	return s
+}
+
+// SendStream writes a binary MESSAGE payload of the given size directly from
+// data, never materializing it - the path for payloads too large for the
+// write buffer. Only transports implementing BinaryStreamer can take it;
+// polling returns ErrStreamingNotSupported, so upgrade first. The stream
+// bypasses the write buffer (ordering against queued packets is the write
+// lock's, not the buffer's) and is checked against the effective max payload
+// when one is known. fn is invoked once the final chunk has been written.
+func (s *socketWithoutUpgrade) SendStream(data io.Reader, size int64, fn func()) error {
+	if SocketStateOpen != s.ReadyState() {
+		return ErrSocketClosed
+	}
+
+	transport := s.Transport()
+	streamer, ok := transport.(BinaryStreamer)
+	if !ok {
+		return ErrStreamingNotSupported
+	}
+
+	maxPayload := int64(s.opts.MaxPayload())
+	if maxPayload <= 0 {
+		maxPayload = s.maxPayload.Load()
+	}
+	if maxPayload > 0 && size > maxPayload {
+		return errors.New("stream of " + strconv.FormatInt(size, 10) + " bytes exceeds max payload " + strconv.FormatInt(maxPayload, 10))
+	}
+
+	client_socket_log.Debug(`streaming %d bytes over "%s"`, size, transport.Name())
+
+	if err := streamer.SendStream(data, size); err != nil {
+		return err
+	}
+
+	if fn != nil {
+		fn()
+	}
+
+	return nil
+}
+
+// SendDatagramPreferred sends msg as a MESSAGE packet over the transport's
+// unreliable datagram channel when one has been negotiated (currently only
+// WebTransport sessions offer one) and falls back to the regular buffered
+// Write path otherwise. The first time a fallback happens on the current
+// transport a "datagramUnavailable" event is emitted with the reason, so the
+// application can switch back to the reliable path.
+func (s *socketWithoutUpgrade) SendDatagramPreferred(msg io.Reader, options *packet.Options, fn func()) SocketWithoutUpgrade {
+	if state := s.ReadyState(); state == SocketStateClosing || state == SocketStateClosed {
+		return s
+	}
+
+	if sender, ok := s.Transport().(DatagramSender); ok && sender.SupportsDatagrams() {
+		pkt := &packet.Packet{
+			Type:    packet.MESSAGE,
+			Options: options,
+		}
+
+		switch v := msg.(type) {
+		case _types.BufferInterface:
+			pkt.Data = v
+		default:
+			buffer := _types.NewBytesBuffer(nil)
+			if _, err := buffer.ReadFrom(msg); err != nil {
+				s.proto.OnError(err)
+				return s
+			}
+			pkt.Data = buffer
+			// The reader has been consumed; fall back with the buffer.
+			msg = buffer
+		}
+
+		err := sender.SendPacketDatagram(pkt)
+		if err == nil {
+			if fn != nil {
+				fn()
+			}
+			return s
+		}
+
+		s.notifyDatagramUnavailable(err)
+	} else {
+		s.notifyDatagramUnavailable(errors.New("transport does not support datagrams"))
+	}
+
+	return s.Write(msg, options, fn)
+}
+
+// notifyDatagramUnavailable emits "datagramUnavailable" once per transport.
+func (s *socketWithoutUpgrade) notifyDatagramUnavailable(reason error) {
+	if s.datagramNotified.CompareAndSwap(false, true) {
+		client_socket_log.Debug("datagram channel unavailable: %v", reason)
+		s.Emit(EventDatagramUnavailable, reason)
+	}
+}
+
+// sendPacket queues a packet for the next flush, silently dropping it when
+// the socket is closing or closed; see trySendPacket for the error-returning
+// variant.
+func (s *socketWithoutUpgrade) sendPacket(t packet.Type, data io.Reader, options *packet.Options, fn func()) {
+	s.queuePacket(t, data, options, successCallback(fn))
+}
+
+// trySendPacket is the error-returning sendPacket; see TrySend.
+func (s *socketWithoutUpgrade) trySendPacket(t packet.Type, data io.Reader, options *packet.Options, fn func()) error {
+	return s.queuePacket(t, data, options, successCallback(fn))
+}
+
+// successCallback adapts a plain done callback to the errorful form stored in
+// writeCallbacks: it fires only when the batch settled without error.
+func successCallback(fn func()) func(error) {
+	if fn == nil {
+		return nil
+	}
+	return func(err error) {
+		if err == nil {
+			fn()
+		}
+	}
+}
+
+// queuePacket queues a packet for the next flush. It returns ErrSocketClosed
+// when the socket is closing or closed - re-checked under the buffer lock, so
+// a close racing the call cannot slip a packet in behind the final flush -
+// and any error from draining data. cb, when non-nil, fires once the
+// transport has settled the packet's batch: with nil after a confirmed
+// write, with the write error otherwise.
+func (s *socketWithoutUpgrade) queuePacket(t packet.Type, data io.Reader, options *packet.Options, cb func(error)) error {
+	if state := s.ReadyState(); state == SocketStateClosing || state == SocketStateClosed {
+		return ErrSocketClosed
+	}
+
+	pkt := &packet.Packet{
+		Type:    t,
+		Options: options,
+	}
+
+	if data != nil {
+		switch v := data.(type) {
+		case _types.BufferInterface:
+			pkt.Data = v
+		default:
+			buffer := _types.NewBytesBuffer(nil)
+			if _, err := buffer.ReadFrom(data); err != nil {
+				s.proto.OnError(err)
+				return err
+			}
+			pkt.Data = buffer
+		}
+	}
+
+	if t == packet.MESSAGE && pkt.Data != nil && s.codecActive.Load() {
+		framed, err := encodeCodecPayload(s.opts.PayloadCodec(), s.opts.PayloadCodecThreshold(), pkt.Data.(_types.BufferInterface))
+		if err != nil {
+			s.proto.OnError(err)
+			return err
+		}
+		pkt.Data = framed
+	}
+
+	// One emission per send, before the packet enters the buffer: a flush
+	// retried after an upgrade replays the queue, not this path.
+	s.Emit(EventPacketCreate, pkt)
+
+	var size int64
+	if buf, ok := pkt.Data.(_types.BufferInterface); ok && buf != nil {
+		size = int64(buf.Len())
+	}
+
+	maxPackets := s.opts.MaxBufferedPackets()
+	maxBytes := s.opts.MaxBufferedBytes()
+
+	for {
+		s.mu.Lock()
+		if s.readyState == SocketStateClosing || s.readyState == SocketStateClosed {
+			s.mu.Unlock()
+			return ErrSocketClosed
+		}
+
+		// An oversized packet is still accepted into an empty buffer -
+		// refusing it forever would deadlock blocking senders.
+		overPackets := maxPackets > 0 && len(s.writeBuffer) >= maxPackets
+		overBytes := maxBytes > 0 && len(s.writeBuffer) > 0 && s.bufferedBytes+size > maxBytes
+		if !overPackets && !overBytes {
+			s.writeBuffer = append(s.writeBuffer, pkt)
+			s.writeCallbacks = append(s.writeCallbacks, cb)
+			s.bufferedBytes += size
+			s.mu.Unlock()
+			s.countPacket(t)
+			break
+		}
+
+		if !s.opts.BlockOnBufferFull() {
+			s.mu.Unlock()
+			return ErrBufferFull
+		}
+
+		if s.bufferRoom == nil {
+			s.bufferRoom = make(chan struct{})
+		}
+		room := s.bufferRoom
+		s.mu.Unlock()
+
+		client_socket_log.Debug("write buffer full - blocking sender until it drains")
+		select {
+		case <-room:
+		case <-s.doneChan():
+			return ErrSocketClosed
+		case <-s.Context().Done():
+			return s.Context().Err()
+		}
+	}
+
+	s.maybeFlush()
+
+	return nil
+}
+
+// queueControlPacket inserts a control packet behind any batch already in
+// flight but ahead of everything still queued, so it leads the next flush.
+// The upgrade machinery uses this instead of handing the packet straight to
+// the transport: a direct Send gets a writer goroutine - and a drain event -
+// of its own, which onDrain would misread as the settlement of a batch
+// another writer is still encoding.
+func (s *socketWithoutUpgrade) QueueControlPacket(pkt *packet.Packet) {
+	s.mu.Lock()
+	at := s.prevBufferLen
+	s.writeBuffer = append(s.writeBuffer, nil)
+	copy(s.writeBuffer[at+1:], s.writeBuffer[at:])
+	s.writeBuffer[at] = pkt
+	s.writeCallbacks = append(s.writeCallbacks, nil)
+	copy(s.writeCallbacks[at+1:], s.writeCallbacks[at:])
+	s.writeCallbacks[at] = nil
+	s.mu.Unlock()
+
+	s.countPacket(pkt.Type)
+}
+
+// maybeFlush flushes a freshly queued packet either immediately - the default
+// - or, with FlushInterval configured, once the coalescing window has passed,
+// so small trickles share one transport write. The FlushMaxPackets and
+// FlushMaxBytes thresholds cut the window short: a batch that is already big
+// enough goes out right away.
+func (s *socketWithoutUpgrade) maybeFlush() {
+	interval := s.opts.FlushInterval()
+	if interval <= 0 {
+		s.Flush()
+		return
+	}
+
+	s.mu.RLock()
+	buffered := len(s.writeBuffer)
+	bufferedBytes := s.bufferedBytes
+	s.mu.RUnlock()
+
+	maxPackets := s.opts.FlushMaxPackets()
+	maxBytes := s.opts.FlushMaxBytes()
+	if (maxPackets > 0 && buffered >= maxPackets) || (maxBytes > 0 && bufferedBytes >= maxBytes) {
+		client_socket_log.Debug("flush threshold reached (%d packets, %d bytes) - flushing early", buffered, bufferedBytes)
+		s.cancelFlushTimer()
+		s.Flush()
+		return
+	}
+
+	s.flushTimerMu.Lock()
+	defer s.flushTimerMu.Unlock()
+
+	if s.flushTimer != nil {
+		return
+	}
+
+	gen := s.generation.Load()
+	s.flushTimer = utils.SetTimeout(func() {
+		s.flushTimerMu.Lock()
+		s.flushTimer = nil
+		s.flushTimerMu.Unlock()
+
+		if s.generation.Load() != gen {
+			return
+		}
+		s.Flush()
+	}, interval)
+}
+
+func (s *socketWithoutUpgrade) cancelFlushTimer() {
+	s.flushTimerMu.Lock()
+	defer s.flushTimerMu.Unlock()
+
+	utils.ClearTimeout(s.flushTimer)
+	s.flushTimer = nil
+}
+
+func (s *socketWithoutUpgrade) cancelOpenTimer() {
+	s.openTimerMu.Lock()
+	defer s.openTimerMu.Unlock()
+
+	utils.ClearTimeout(s.openTimer)
+	s.openTimer = nil
+}
+
+// BufferedAmount returns the payload bytes currently queued in the write
+// buffer, so applications can implement their own flow control. Packets
+// handed to the transport stay counted until the drain confirms the write -
+// a slow polling POST still shows as buffered - so the number only shrinks
+// when bytes are really gone.
+func (s *socketWithoutUpgrade) BufferedAmount() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.bufferedBytes
+}
+
+// PendingPackets returns how many packets are waiting to leave the socket:
+// the queued ones plus the in-flight batch the active transport is still
+// writing. Like BufferedAmount, the count drops on drain, not on flush.
+func (s *socketWithoutUpgrade) PendingPackets() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.writeBuffer)
+}
+
+// WaitForDrain blocks until everything buffered has been written out - the
+// write buffer is empty and the transport reports writable again - so a
+// shutdown can be sure the last batch really left. It returns ctx's error on
+// cancellation and ErrSocketClosed when the socket closes (or is already
+// closed) with data still pending; a nil ctx waits indefinitely.
+func (s *socketWithoutUpgrade) WaitForDrain(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	for {
+		// Subscribe before checking, so a drain landing between the check
+		// and the wait cannot be missed.
+		wake := make(chan struct{}, 1)
+		notify := func(...any) {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+		s.On(EventDrain, notify)
+		s.On(EventClose, notify)
+
+		s.mu.RLock()
+		empty := len(s.writeBuffer) == 0
+		transport := s.transport
+		s.mu.RUnlock()
+
+		done := empty && transport != nil && transport.Writable()
+		closed := SocketStateClosed == s.ReadyState()
+
+		if done || closed {
+			s.RemoveListener(EventDrain, notify)
+			s.RemoveListener(EventClose, notify)
+			if done {
+				return nil
+			}
+			return ErrSocketClosed
+		}
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			s.RemoveListener(EventDrain, notify)
+			s.RemoveListener(EventClose, notify)
+			return ctx.Err()
+		}
+		s.RemoveListener(EventDrain, notify)
+		s.RemoveListener(EventClose, notify)
+	}
+}
+
+// belowLowWater reports whether the write buffer is small enough to announce
+// "drain": empty when no caps are configured, at or below half of each
+// configured cap otherwise.
+func (s *socketWithoutUpgrade) belowLowWater(packets int, bytes int64) bool {
+	maxPackets := s.opts.MaxBufferedPackets()
+	maxBytes := s.opts.MaxBufferedBytes()
+
+	if maxPackets <= 0 && maxBytes <= 0 {
+		return packets == 0
+	}
+	if maxPackets > 0 && packets > maxPackets/2 {
+		return false
+	}
+	if maxBytes > 0 && bytes > maxBytes/2 {
+		return false
+	}
+	return true
+}
+
+// invokeWriteCallback runs a Send/Write done callback with the outcome of
+// its batch. It is called from the flush/drain goroutines, so a panic inside
+// the callback would wedge the connection; instead the panic is recovered
+// and surfaced as an "error" event carrying the stack, unless
+// RepanicWriteCallbacks asks for fail-fast.
+func (s *socketWithoutUpgrade) invokeWriteCallback(cb func(error), err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if s.opts.RepanicWriteCallbacks() {
+				panic(r)
+			}
+			client_socket_log.Debug("write callback panic: %v", r)
+			s.Emit(EventError, NewError("write callback panic", fmt.Errorf("%v\n%s", r, debug.Stack()), r))
+		}
+	}()
+
+	cb(err)
+}
+
+// Close closes the connection, draining buffered packets first. When a
+// CloseTimeout is configured the drain wait is bounded and the close is
+// forced once the timeout elapses.
+func (s *socketWithoutUpgrade) Close() SocketWithoutUpgrade {
+	var closeTimeoutTimer *utils.Timer
+
+	gen := s.generation.Load()
+
+	closeTransport := func() {
+		if s.generation.Load() != gen {
+			return
+		}
+		utils.ClearTimeout(closeTimeoutTimer)
+		s.proto.OnClose("forced close", nil)
+		client_socket_log.Debug("socket closing - telling transport to close")
+		if transport := s.Transport(); transport != nil {
+			transport.Close()
+		}
+	}
+
+	var once sync.Once
+	cleanupAndClose := func(...any) {
+		once.Do(closeTransport)
+	}
+
+	waitForUpgrade := func() {
+		// Wait for the upgrade to finish since we can't send packets while
+		// pausing a transport.
+		s.Once(EventUpgrade, cleanupAndClose)
+		s.Once(EventUpgradeError, cleanupAndClose)
+	}
+
+	if state := s.ReadyState(); state == SocketStateOpening || state == SocketStateOpen {
+		s.setReadyState(SocketStateClosing)
+
+		if timeout := s.opts.CloseTimeout(); timeout > 0 {
+			closeTimeoutTimer = utils.SetTimeout(func() {
+				if s.generation.Load() != gen {
+					return
+				}
+				client_socket_log.Debug("close timed out - forcing transport close")
+				s.proto.OnClose("close timeout", errors.New("close timeout"))
+			}, timeout)
+		}
+
+		if s.WriteBufferLen() > 0 {
+			// With buffer caps the drain event can fire at the low-water
+			// mark with packets still queued; keep waiting until the buffer
+			// is actually empty.
+			var onDrainClose func(...any)
+			onDrainClose = func(...any) {
+				if s.generation.Load() != gen {
+					return
+				}
+				if s.WriteBufferLen() > 0 {
+					s.Once(EventDrain, onDrainClose)
+					return
+				}
+				if s.Upgrading() {
+					waitForUpgrade()
+				} else {
+					closeTransport()
+				}
+			}
+			s.Once(EventDrain, onDrainClose)
+		} else if s.Upgrading() {
+			waitForUpgrade()
+		} else {
+			closeTransport()
+		}
+	}
+
+	return s
+}
+
+// CloseContext closes the connection like Close but guarantees a return
+// within ctx's deadline. The graceful path - drain, close packet, transport
+// teardown - runs as usual; when ctx expires first the close is forced
+// through, goroutines still stuck in a transport write are orphaned (they
+// exit once their request or connection dies, and are logged), and ctx.Err()
+// is returned. A nil return means the close completed gracefully in time.
+func (s *socketWithoutUpgrade) CloseContext(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// Grab the current attempt's channel before closing: a reconnect racing
+	// in behind the close would swap in a fresh one and leave this waiting
+	// on the wrong attempt.
+	done := s.doneChan()
+
+	s.proto.Close()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		client_socket_log.Debug("close deadline expired - forcing transport close, orphaning in-flight writes")
+		s.proto.OnClose("forced close", ctx.Err())
+		return ctx.Err()
+	}
+}
+
+// OnError is called upon transport error.
+func (s *socketWithoutUpgrade) OnError(err error) {
+	client_socket_log.Debug("socket error %v", err)
+	s.SetPriorWebsocketSuccess(false)
+	s.Emit(EventError, err)
+
+	// With a TransportErrorThreshold configured, errors on an established
+	// socket feed the per-transport error rate instead of closing the socket
+	// right away; crossing the threshold emits "transportDegraded" so the
+	// upgrade machinery can probe an alternative. Fatal conditions still
+	// surface through the transport "close" event.
+	if threshold := s.opts.TransportErrorThreshold(); threshold > 0 && SocketStateOpen == s.ReadyState() {
+		if transport := s.Transport(); transport != nil {
+			rate := s.recordTransportError(transport.Name())
+			client_socket_log.Debug(`transport "%s" error rate %.2f/min (threshold %.2f)`, transport.Name(), rate, threshold)
+			if rate > threshold {
+				s.Emit(EventTransportDegraded, transport.Name(), rate)
+			}
+		}
+		return
+	}
+
+	s.proto.OnClose("transport error", err)
+}
+
+// recordTransportError notes an error against the named transport and returns
+// its current rate in errors per minute.
+func (s *socketWithoutUpgrade) recordTransportError(name string) float64 {
+	now := time.Now()
+	cutoff := now.Add(-time.Minute)
+
+	s.transportErrMu.Lock()
+	defer s.transportErrMu.Unlock()
+
+	stamps := append(s.transportErrors[name], now)
+	for len(stamps) > 0 && stamps[0].Before(cutoff) {
+		stamps = stamps[1:]
+	}
+	s.transportErrors[name] = stamps
+
+	return float64(len(stamps))
+}
+
+// OnClose is called upon transport close.
+func (s *socketWithoutUpgrade) OnClose(reason string, description error) {
+	if state := s.ReadyState(); state == SocketStateOpening || state == SocketStateOpen || state == SocketStateClosing {
+		client_socket_log.Debug(`socket close with reason: "%s"`, reason)
+
+		s.timerMu.Lock()
+		utils.ClearTimeout(s.pingTimeoutTimer)
+		s.timerMu.Unlock()
+
+		s.cancelV3PingTimer()
+		s.cancelFlushTimer()
+		s.cancelOpenTimer()
+		s.cancelHandshakeTimer()
+
+		transportName := ""
+		if transport := s.Transport(); transport != nil {
+			transportName = transport.Name()
+
+			// The transport's own close event is silenced below, so fold any
+			// packets it knows were never written into the description here.
+			if undelivered := transport.Undelivered(); len(undelivered) > 0 {
+				if _, ok := description.(*CloseDetails); !ok {
+					description = &CloseDetails{Description: description, Undelivered: undelivered}
+				}
+			}
+
+			// Stop event propagation from the dying transport, then make
+			// sure it is gone.
+			transport.RemoveAllListeners(EventClose)
+			transport.Close()
+			transport.Clear()
+		}
+
+		// Stamp the close details with the session's transport history; a
+		// plain error cause is wrapped so the path has a place to ride.
+		if path := s.ConnectionPath(); len(path) > 0 && description != nil {
+			switch details := description.(type) {
+			case *CloseDetails:
+				details.ConnectionPath = path
+			default:
+				description = &CloseDetails{Description: details, ConnectionPath: path}
+			}
+		}
+
+		s.setReadyState(SocketStateClosed)
+		s.id.Store("")
+		s.closeDone()
+
+		s.Emit(EventClose, reason, description)
+
+		// Clean buffers after close event is emitted, so listeners can still
+		// inspect them.
+		s.mu.Lock()
+		pending := s.writeCallbacks
+		s.writeBuffer = nil
+		s.writeCallbacks = nil
+		s.bufferedBytes = 0
+		s.prevBufferLen = 0
+		if s.bufferRoom != nil {
+			close(s.bufferRoom)
+			s.bufferRoom = nil
+		}
+		s.mu.Unlock()
+
+		// Whatever was still queued will never be written; settle its
+		// callbacks with the close as the error.
+		err := description
+		if err == nil {
+			err = ErrSocketClosed
+		}
+		for _, cb := range pending {
+			if cb != nil {
+				s.invokeWriteCallback(cb, err)
+			}
+		}
+
+		if reason == "ping timeout" {
+			s.notePingTimeout(transportName)
+		}
+
+		// A websocket-first attempt taken on the strength of RememberUpgrade
+		// that failed before opening retries with the normal transport
+		// ordering instead of giving up.
+		if s.wsShortcut.CompareAndSwap(true, false) {
+			client_socket_log.Debug("remembered websocket attempt failed - retrying with normal ordering")
+			s.SetPriorWebsocketSuccess(false)
+			s.proto.Open()
+			return
+		}
+
+		if !s.maybeScheduleReconnect(reason) {
+			s.fireClosed(reason, description)
+		}
+	}
+}
+
+// notePingTimeout tallies one ping-timeout close against the given transport.
+// Crossing DowngradeAfterPingTimeouts flags the transport as problematic -
+// once per socket - and emits "transportDowngrade" with the name and count.
+// Polling is never flagged; it is what the socket downgrades to.
+func (s *socketWithoutUpgrade) notePingTimeout(name string) {
+	threshold := s.opts.DowngradeAfterPingTimeouts()
+	if threshold <= 0 || name == "" || name == "polling" {
+		return
+	}
+
+	s.pingTimeoutsMu.Lock()
+	s.pingTimeouts[name]++
+	count := s.pingTimeouts[name]
+	crossed := count >= threshold && !s.problemTransports[name]
+	if crossed {
+		s.problemTransports[name] = true
+	}
+	s.pingTimeoutsMu.Unlock()
+
+	if crossed {
+		client_socket_log.Debug(`transport "%s" hit %d ping timeouts - downgrading to polling on reconnect`, name, count)
+		s.Emit(EventTransportDowngrade, name, count)
+	}
+}
+
+// TransportProblematic reports whether the named transport has been flagged
+// by the ping-timeout accounting; see DowngradeAfterPingTimeouts.
+func (s *socketWithoutUpgrade) TransportProblematic(name string) bool {
+	s.pingTimeoutsMu.Lock()
+	defer s.pingTimeoutsMu.Unlock()
+
+	return s.problemTransports[name]
+}
+
+// ClearCookies drops the cookies the active transport's HTTP client holds for
+// the connection's host - typically session cookies after a logout - so
+// subsequent requests start fresh without recreating the socket. Only the
+// polling transport carries a cookie jar; on others this is a no-op.
+func (s *socketWithoutUpgrade) ClearCookies() {
+	if transport, ok := s.Transport().(interface{ ClearCookies() }); ok {
+		transport.ClearCookies()
+	}
+}
+
+// OnClosed registers fn to run exactly once when the socket reaches its
+// terminal closed state - closed with no reconnect attempt pending. Unlike
+// the "close" event, which internal close paths may fire more than once, this
+// is the hook for one-shot teardown of application resources. When the socket
+// is already terminally closed, fn runs immediately with the recorded reason.
+func (s *socketWithoutUpgrade) OnClosed(fn func(reason error)) {
+	if fn == nil {
+		return
+	}
+
+	s.closedMu.Lock()
+	if s.closedFired {
+		reason := s.closedReason
+		s.closedMu.Unlock()
+		fn(reason)
+		return
+	}
+	s.closedCallbacks = append(s.closedCallbacks, fn)
+	s.closedMu.Unlock()
+}
+
+// fireClosed settles the OnClosed callbacks, exactly once for the socket's
+// lifetime no matter how many close paths converge here.
+func (s *socketWithoutUpgrade) fireClosed(reason string, description error) {
+	s.closedOnce.Do(func() {
+		err := description
+		if err == nil {
+			err = errors.New(reason)
+		}
+
+		s.closedMu.Lock()
+		s.closedFired = true
+		s.closedReason = err
+		callbacks := s.closedCallbacks
+		s.closedCallbacks = nil
+		s.closedMu.Unlock()
+
+		for _, fn := range callbacks {
+			fn(err)
+		}
+	})
+}
+
+// maybeScheduleReconnect arms the next reconnect attempt after a close, when
+// the Reconnection option asks for it, and reports whether one was scheduled.
+// Deliberate closes - a user Close, a canceled context, an expired close
+// deadline - stay final.
+func (s *socketWithoutUpgrade) maybeScheduleReconnect(reason string) bool {
+	if !s.opts.Reconnection() {
+		return false
+	}
+	switch reason {
+	case "forced close", "close timeout", "context canceled":
+		return false
+	}
+
+	attempt := int(s.reconnectAttempts.Add(1))
+
+	// MaxReconnectionAttempts bounds the failure streak; the counter was
+	// reset on the last successful open, so this is consecutive failures.
+	if limit := s.opts.MaxReconnectionAttempts(); limit > 0 && attempt > limit {
+		client_socket_log.Debug("giving up reconnecting after %d attempts", limit)
+		s.Emit(EventReconnectFailed, limit)
+		return false
+	}
+
+	delay := s.reconnectDelay(attempt)
+
+	client_socket_log.Debug("reconnect attempt %d scheduled in %v", attempt, delay)
+	s.Emit(EventReconnectScheduled, attempt, delay)
+
+	utils.SetTimeout(func() {
+		if SocketStateClosed != s.ReadyState() {
+			return
+		}
+		client_socket_log.Debug("reconnect attempt %d starting", attempt)
+		s.proto.Open()
+	}, delay)
+
+	return true
+}
+
+// reconnectDelay computes the jittered exponential backoff for the given
+// attempt: ReconnectionDelay doubled per attempt, capped by
+// ReconnectionDelayMax, spread by RandomizationFactor.
+func (s *socketWithoutUpgrade) reconnectDelay(attempt int) time.Duration {
+	delay := s.opts.ReconnectionDelay()
+	if delay <= 0 {
+		delay = time.Second
+	}
+	maxDelay := s.opts.ReconnectionDelayMax()
+	if maxDelay <= 0 {
+		maxDelay = 5 * time.Second
+	}
+
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	factor := 0.5
+	if s.opts.GetRawRandomizationFactor() != nil {
+		factor = s.opts.RandomizationFactor()
+	}
+	if factor > 0 {
+		jitter := time.Duration(float64(delay) * factor * (2*rand.Float64() - 1))
+		delay += jitter
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+		if delay < 0 {
+			delay = 0
+		}
+	}
+
+	return delay
+}
@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// socket is the general-purpose client: it starts on long-polling and
+// upgrades when the server allows it.
+type socket struct {
+	SocketWithUpgrade
+}
+
+// MakeSocket returns a socket yet to be constructed.
+func MakeSocket() Socket {
+	s := &socket{
+		SocketWithUpgrade: MakeSocketWithUpgrade(),
+	}
+
+	s.Prototype(s)
+
+	return s
+}
+
+// NewSocket creates a client for the given URI and opens it immediately.
+//
+//	socket := engine.NewSocket("http://localhost:8080", nil)
+//	socket.On(EventOpen, func(...any) {
+//		socket.Send(types.NewStringBufferString("hello"), nil, nil)
+//	})
+func NewSocket(uri string, opts SocketOptionsInterface) Socket {
+	s := MakeSocket()
+
+	s.Construct(uri, opts)
+
+	return s
+}
+
+// NewSocketContext is like NewSocket but ties the socket's lifetime to ctx;
+// see NewSocketWithoutUpgradeContext.
+func NewSocketContext(ctx context.Context, uri string, opts SocketOptionsInterface) Socket {
+	s := MakeSocket()
+
+	s.SetContext(ctx)
+	s.Construct(uri, opts)
+
+	return s
+}
+
+// NewSocketE is like NewSocket but validates the URI and options up front,
+// returning a descriptive error instead of a socket that never connects. All
+// validation failures are aggregated into the one error. Nothing is
+// constructed on failure, so there are no timers or transports to clean up.
+func NewSocketE(uri string, opts SocketOptionsInterface) (Socket, error) {
+	return NewSocketContextE(context.Background(), uri, opts)
+}
+
+// NewSocketContextE is the context-bound variant of NewSocketE.
+func NewSocketContextE(ctx context.Context, uri string, opts SocketOptionsInterface) (Socket, error) {
+	if err := validateSocketConfig(uri, opts); err != nil {
+		return nil, err
+	}
+
+	return NewSocketContext(ctx, uri, opts), nil
+}
+
+// validateSocketConfig checks the parts of a socket's configuration that
+// Construct would otherwise swallow: a parseable URI with a supported scheme
+// and a host, a numeric port and a non-empty transports set. Every problem
+// found is reported, joined into one error.
+func validateSocketConfig(uri string, opts SocketOptionsInterface) error {
+	var errs []error
+
+	if uri != "" {
+		parsed, err := url.Parse(uri)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid uri %q: %w", uri, err))
+		} else {
+			switch parsed.Scheme {
+			case "http", "https", "ws", "wss":
+			default:
+				errs = append(errs, fmt.Errorf("unsupported uri scheme %q", parsed.Scheme))
+			}
+			if parsed.Hostname() == "" {
+				errs = append(errs, fmt.Errorf("uri %q has no host", uri))
+			}
+		}
+	}
+
+	if opts != nil {
+		if port := opts.Port(); port != "" {
+			if _, err := strconv.Atoi(port); err != nil {
+				errs = append(errs, fmt.Errorf("port %q is not numeric", port))
+			}
+		}
+		if transports := opts.GetRawTransports(); transports != nil && transports.Len() == 0 {
+			errs = append(errs, errors.New("transports set is empty"))
+		}
+	}
+
+	return errors.Join(errs...)
+}
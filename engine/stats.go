@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/zishang520/engine.io-go-parser/packet"
+)
+
+// TransportStats is a snapshot of the wire-level accounting of a single
+// transport, tagged with the transport name. Byte counts approximate what
+// actually crossed the wire: HTTP header and body sizes for polling, frame
+// overhead plus payload for websocket, stream frame bytes for webtransport.
+type TransportStats struct {
+	Transport     string
+	BytesSent     uint64
+	BytesReceived uint64
+
+	// NoopsReceived counts server-sent NOOP packets. Servers use NOOPs to
+	// kick pending long-polls during upgrades, so an unexpected rate here is
+	// an early indicator of upgrade thrash.
+	NoopsReceived uint64
+}
+
+// ConnectTimings breaks a connection attempt's time-to-connect into phases.
+// It rides the socket's "open" event and is available afterwards via
+// ConnectTimings(); each Open resets it.
+type ConnectTimings struct {
+	// Dial spans the Open call (transport creation, DNS, dial, protocol
+	// handshake) to the transport reporting open.
+	Dial time.Duration
+
+	// Handshake spans the transport opening to the server's OPEN packet.
+	Handshake time.Duration
+
+	// Upgrade spans the socket opening to a completed transport upgrade,
+	// zero when none has happened.
+	Upgrade time.Duration
+}
+
+// FlushedPacket describes one packet of a flushed batch: its type and its
+// payload size in bytes. A slice of these rides every "flush" event, so the
+// actual write batching can be inspected.
+type FlushedPacket struct {
+	Type packet.Type
+	Size int64
+}
+
+// TransportMetrics is a snapshot of a transport's message-level counters:
+// payloads received, frames written and the packets they carried. Unlike
+// TransportStats it does not try to approximate HTTP overhead, making it the
+// cheap choice for per-connection accounting; reading it costs four atomic
+// loads.
+type TransportMetrics struct {
+	BytesSent       uint64
+	BytesReceived   uint64
+	PacketsSent     uint64
+	PacketsReceived uint64
+}
+
+// add merges another snapshot into the receiver.
+func (s *TransportStats) add(other TransportStats) {
+	s.BytesSent += other.BytesSent
+	s.BytesReceived += other.BytesReceived
+	s.NoopsReceived += other.NoopsReceived
+}
+
+// httpRequestSize approximates the on-wire size of an HTTP request: request
+// line, headers and body.
+func httpRequestSize(method string, uri string, headers http.Header, bodyLen int) uint64 {
+	// METHOD SP URI SP HTTP/1.1 CRLF
+	size := uint64(len(method) + 1 + len(uri) + 1 + len("HTTP/1.1") + 2)
+	size += httpHeaderSize(headers)
+	size += 2 // terminating CRLF
+	size += uint64(bodyLen)
+	return size
+}
+
+// httpResponseSize approximates the on-wire size of an HTTP response: status
+// line, headers and body.
+func httpResponseSize(res *http.Response, bodyLen int) uint64 {
+	// HTTP/1.1 SP STATUS CRLF
+	size := uint64(len("HTTP/1.1") + 1 + len(res.Status) + 2)
+	size += httpHeaderSize(res.Header)
+	size += 2 // terminating CRLF
+	size += uint64(bodyLen)
+	return size
+}
+
+func httpHeaderSize(headers http.Header) uint64 {
+	var size uint64
+	for key, values := range headers {
+		for _, value := range values {
+			// KEY: VALUE CRLF
+			size += uint64(len(key) + 2 + len(value) + 2)
+		}
+	}
+	return size
+}
+
+// websocketFrameSize approximates the on-wire size of a websocket frame
+// carrying a payload of the given length: 2-byte header, extended length
+// field when needed, 4-byte masking key for client-to-server frames.
+func websocketFrameSize(payloadLen int, masked bool) uint64 {
+	size := uint64(2 + payloadLen)
+	switch {
+	case payloadLen > 0xffff:
+		size += 8
+	case payloadLen > 125:
+		size += 2
+	}
+	if masked {
+		size += 4
+	}
+	return size
+}
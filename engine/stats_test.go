@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_types "github.com/zishang520/engine.io-go-parser/types"
+)
+
+// collectMessages returns a channel the socket's message payloads arrive on.
+func collectMessages(s SocketWithoutUpgrade) <-chan any {
+	messages := make(chan any, 64)
+	s.On(EventMessage, func(args ...any) {
+		if len(args) > 0 {
+			select {
+			case messages <- args[0]:
+			default:
+			}
+		}
+	})
+	return messages
+}
+
+// echoRound sends count messages and waits for each echo to come back.
+func echoRound(t *testing.T, s Socket, count int) {
+	t.Helper()
+
+	messages := collectMessages(s)
+	for i := 0; i < count; i++ {
+		s.Send(_types.NewStringBufferString("wire-accounting-probe"), nil, nil)
+	}
+	for i := 0; i < count; i++ {
+		select {
+		case <-messages:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("echo %d of %d never arrived", i+1, count)
+		}
+	}
+}
+
+// TestWireAccountingPollingVsWebsocket drives the same message stream over
+// each transport and checks the wire-level accounting: both record traffic,
+// and polling pays visibly more per message (one HTTP request per POST and
+// per poll) than websocket's frame overhead.
+func TestWireAccountingPollingVsWebsocket(t *testing.T) {
+	url := newTestServer(t, nil)
+
+	run := func(opts SocketOptionsInterface) (sent, received uint64) {
+		s := openSocket(t, url, opts)
+		echoRound(t, s, 5)
+
+		for _, stat := range s.Stats() {
+			sent += stat.BytesSent
+			received += stat.BytesReceived
+		}
+		s.Close()
+		return sent, received
+	}
+
+	pollingSent, pollingReceived := run(pollingOnly())
+	websocketSent, websocketReceived := run(websocketOnly())
+
+	if pollingSent == 0 || pollingReceived == 0 {
+		t.Fatalf("polling recorded no traffic: sent=%d received=%d", pollingSent, pollingReceived)
+	}
+	if websocketSent == 0 || websocketReceived == 0 {
+		t.Fatalf("websocket recorded no traffic: sent=%d received=%d", websocketSent, websocketReceived)
+	}
+	if pollingSent <= websocketSent {
+		t.Errorf("expected polling overhead to exceed websocket: polling sent %d bytes, websocket %d", pollingSent, websocketSent)
+	}
+}
+
+// TestNetDialContextHookBothTransports verifies the custom dial hook is what
+// actually opens the connections, for polling and websocket alike.
+func TestNetDialContextHookBothTransports(t *testing.T) {
+	url := newTestServer(t, nil)
+
+	for _, tc := range []struct {
+		name string
+		opts *SocketOptions
+	}{
+		{"polling", pollingOnly()},
+		{"websocket", websocketOnly()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var dials atomic.Int64
+			var dialer net.Dialer
+			tc.opts.SetNetDialContext(func(ctx context.Context, network string, addr string) (net.Conn, error) {
+				dials.Add(1)
+				return dialer.DialContext(ctx, network, addr)
+			})
+
+			s := openSocket(t, url, tc.opts)
+			echoRound(t, s, 1)
+			s.Close()
+
+			if dials.Load() == 0 {
+				t.Errorf("NetDialContext hook was never invoked on the %s transport", tc.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+)
+
+// transportPaths builds a polling and a websocket transport with opts and
+// returns the path component each would dial.
+func transportPaths(t *testing.T, url string, opts SocketOptionsInterface) (pollingPath, wsPath string) {
+	t.Helper()
+
+	s := NewSocket(url, opts)
+	t.Cleanup(func() { s.Close() })
+
+	pt, err := s.CreateTransport("polling")
+	if err != nil {
+		t.Fatalf("creating polling transport: %v", err)
+	}
+	wt, err := s.CreateTransport("websocket")
+	if err != nil {
+		t.Fatalf("creating websocket transport: %v", err)
+	}
+
+	return pt.(*polling).uri().Path, wt.(*websocket).uri().Path
+}
+
+// TestAddTrailingSlash checks the option steers the trailing slash of both
+// the polling GET URL and the websocket dial URL, and that the two agree
+// with each other under either setting.
+func TestAddTrailingSlash(t *testing.T) {
+	url := hangingServer(t)
+
+	withSlash, wsWithSlash := transportPaths(t, url, DefaultSocketOptions())
+
+	without := DefaultSocketOptions()
+	without.SetAddTrailingSlash(false)
+	withoutSlash, wsWithoutSlash := transportPaths(t, url, without)
+
+	if withSlash != wsWithSlash {
+		t.Errorf("polling path %q and websocket path %q disagree", withSlash, wsWithSlash)
+	}
+	if withoutSlash != wsWithoutSlash {
+		t.Errorf("polling path %q and websocket path %q disagree", withoutSlash, wsWithoutSlash)
+	}
+
+	// Default matches upstream: the slash is appended.
+	if !strings.HasSuffix(withSlash, "/") {
+		t.Errorf("path %q lacks the trailing slash with the default setting", withSlash)
+	}
+	if strings.HasSuffix(withoutSlash, "/") {
+		t.Errorf("path %q kept the trailing slash with the option off", withoutSlash)
+	}
+
+	// The setting only moves the slash; the paths are otherwise identical.
+	if withSlash != withoutSlash+"/" {
+		t.Errorf("paths %q and %q differ beyond the trailing slash", withSlash, withoutSlash)
+	}
+}
+
+// TestAddTrailingSlashNotDoubled configures a path that already carries the
+// slash and checks it is not doubled - and still stripped when the option is
+// off.
+func TestAddTrailingSlashNotDoubled(t *testing.T) {
+	url := hangingServer(t)
+
+	opts := DefaultSocketOptions()
+	opts.SetPath("/custom/")
+	pollingPath, wsPath := transportPaths(t, url, opts)
+
+	if pollingPath != "/custom/" || wsPath != "/custom/" {
+		t.Errorf("paths = %q, %q - the configured slash must not double", pollingPath, wsPath)
+	}
+
+	stripped := DefaultSocketOptions()
+	stripped.SetPath("/custom/")
+	stripped.SetAddTrailingSlash(false)
+	pollingPath, wsPath = transportPaths(t, url, stripped)
+
+	if pollingPath != "/custom" || wsPath != "/custom" {
+		t.Errorf("paths = %q, %q - the configured slash must be stripped", pollingPath, wsPath)
+	}
+}
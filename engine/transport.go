@@ -0,0 +1,508 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/zishang520/engine.io-go-parser/packet"
+	"github.com/zishang520/engine.io-go-parser/parser"
+	_types "github.com/zishang520/engine.io-go-parser/types"
+	"github.com/zishang520/engine.io/v2/events"
+	"github.com/zishang520/engine.io/v2/log"
+
+	"github.com/zishang520/engine.io-client/request"
+)
+
+var client_transport_log = log.NewLog("engine.io-client:transport")
+
+// transport is the state machine shared by every concrete transport. It never
+// talks to the network itself; DoOpen, DoClose and Write are dispatched to
+// the outermost implementation through the prototype.
+type transport struct {
+	events.EventEmitter
+
+	proto Transport
+
+	opts   SocketOptionsInterface
+	socket SocketWithoutUpgrade
+
+	mu         sync.RWMutex
+	query      url.Values
+	readyState TransportState
+	writable   atomic.Bool
+
+	wireBytesSent     atomic.Uint64
+	wireBytesReceived atomic.Uint64
+
+	bytesSent       atomic.Uint64
+	bytesReceived   atomic.Uint64
+	packetsSent     atomic.Uint64
+	packetsReceived atomic.Uint64
+	noopsReceived   atomic.Uint64
+
+	// undelivered is the tail of the most recent write batch that was
+	// definitely not written; OnClose folds it into the close details.
+	undeliveredMu sync.Mutex
+	undelivered   []*packet.Packet
+
+	// wildcards holds the OnAny listeners notified on every Emit.
+	wildcards anyListeners
+}
+
+// MakeTransport returns a bare transport base to be embedded by a concrete
+// implementation.
+func MakeTransport() Transport {
+	t := &transport{
+		EventEmitter: events.New(),
+	}
+
+	t.Prototype(t)
+
+	return t
+}
+
+func NewTransport(socket SocketWithoutUpgrade, opts SocketOptionsInterface) Transport {
+	t := MakeTransport()
+
+	t.Construct(socket, opts)
+
+	return t
+}
+
+func (t *transport) Prototype(proto Transport) {
+	t.proto = proto
+}
+
+func (t *transport) Proto() Transport {
+	return t.proto
+}
+
+func (t *transport) Construct(socket SocketWithoutUpgrade, opts SocketOptionsInterface) {
+	t.socket = socket
+	t.opts = opts
+
+	// Clone the query so later mutation of the caller's map cannot race
+	// the uri builders.
+	t.query = url.Values{}
+	for key, values := range opts.Query() {
+		t.query[key] = append([]string(nil), values...)
+	}
+}
+
+// Emit notifies the OnAny wildcard listeners before forwarding to the
+// embedded emitter; see the socket's OnAny.
+func (t *transport) Emit(evt events.EventName, args ...any) {
+	t.wildcards.dispatch(evt, args...)
+	t.EventEmitter.Emit(evt, args...)
+}
+
+// OnAny registers fn to run for every event this transport emits, internal
+// ones like "poll" and "drain" included.
+func (t *transport) OnAny(fn AnyListener) {
+	t.wildcards.add(fn)
+}
+
+// OffAny removes a wildcard listener registered with OnAny; nil removes them
+// all. Reports whether anything was removed.
+func (t *transport) OffAny(fn AnyListener) bool {
+	return t.wildcards.remove(fn)
+}
+
+// Name is overridden by every concrete transport.
+func (t *transport) Name() string { return "" }
+
+func (t *transport) Opts() SocketOptionsInterface { return t.opts }
+
+func (t *transport) Socket() SocketWithoutUpgrade { return t.socket }
+
+func (t *transport) Query() url.Values {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.query
+}
+
+func (t *transport) SetQuery(query url.Values) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.query = query
+}
+
+func (t *transport) ReadyState() TransportState {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.readyState
+}
+
+func (t *transport) SetReadyState(state TransportState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.readyState = state
+}
+
+func (t *transport) Writable() bool {
+	return t.writable.Load()
+}
+
+func (t *transport) SetWritable(writable bool) {
+	// Swap rather than Store so the not-writable-to-writable edge is
+	// detected exactly once even under concurrent calls.
+	if was := t.writable.Swap(writable); writable && !was {
+		t.Emit(EventWritable)
+	}
+}
+
+// Stats returns a snapshot of the transport's wire-level byte accounting.
+func (t *transport) Stats() TransportStats {
+	return TransportStats{
+		Transport:     t.proto.Name(),
+		BytesSent:     t.wireBytesSent.Load(),
+		BytesReceived: t.wireBytesReceived.Load(),
+		NoopsReceived: t.noopsReceived.Load(),
+	}
+}
+
+// CountWireBytes adds to the transport's wire-level counters and notifies the
+// metrics hook when one is configured. Concrete transports call it with their
+// best estimate of what crossed the wire, including framing overhead.
+func (t *transport) CountWireBytes(sent uint64, received uint64) {
+	t.wireBytesSent.Add(sent)
+	t.wireBytesReceived.Add(received)
+
+	if hook := t.opts.MetricsHook(); hook != nil {
+		hook(t.Stats())
+	}
+}
+
+// Metrics returns a snapshot of the transport's message-level counters.
+func (t *transport) Metrics() TransportMetrics {
+	return TransportMetrics{
+		BytesSent:       t.bytesSent.Load(),
+		BytesReceived:   t.bytesReceived.Load(),
+		PacketsSent:     t.packetsSent.Load(),
+		PacketsReceived: t.packetsReceived.Load(),
+	}
+}
+
+// CountSent adds to the send-side metrics counters; concrete transports call
+// it once packets have been written, with the framed byte size where the
+// transport frames messages itself.
+func (t *transport) CountSent(packets uint64, bytes uint64) {
+	t.packetsSent.Add(packets)
+	t.bytesSent.Add(bytes)
+}
+
+// CountReceived adds to the receive-side metrics counters. The base OnData
+// and OnPacket take care of it for transports that deliver one packet at a
+// time; polling counts each decoded payload itself.
+func (t *transport) CountReceived(packets uint64, bytes uint64) {
+	t.packetsReceived.Add(packets)
+	t.bytesReceived.Add(bytes)
+}
+
+// SetUndelivered records the packets of the current write batch that were
+// definitely not handed to the wire; concrete transports call it from their
+// Write implementations, with nil once a batch fully went out.
+func (t *transport) SetUndelivered(packets []*packet.Packet) {
+	t.undeliveredMu.Lock()
+	defer t.undeliveredMu.Unlock()
+
+	t.undelivered = packets
+}
+
+// Undelivered returns the packets recorded by SetUndelivered.
+func (t *transport) Undelivered() []*packet.Packet {
+	t.undeliveredMu.Lock()
+	defer t.undeliveredMu.Unlock()
+
+	return t.undelivered
+}
+
+// notifyHandshakeResponse runs the OnHandshakeResponse hook with the headers
+// of the response that opened the connection. It only fires for the socket's
+// initial transport - probe transports open while the socket is already open
+// - and before the "open" event.
+func notifyHandshakeResponse(t Transport, headers http.Header) {
+	hook := t.Opts().OnHandshakeResponse()
+	if hook == nil || headers == nil {
+		return
+	}
+	if socket := t.Socket(); socket == nil || SocketStateOpening != socket.ReadyState() {
+		return
+	}
+
+	hook(headers)
+}
+
+// requestHeaders assembles the headers sent with a request or dial: the
+// static ExtraHeaders, the per-request ExtraHeadersFn result merged over them
+// (the dynamic value wins per header key - fresh credentials beat stale
+// static ones), and the User-Agent on top.
+func requestHeaders(opts SocketOptionsInterface) http.Header {
+	headers := http.Header{}
+	for key, values := range opts.ExtraHeaders() {
+		for _, value := range values {
+			headers.Add(key, value)
+		}
+	}
+	if fn := opts.ExtraHeadersFn(); fn != nil {
+		for key, values := range fn() {
+			headers.Del(key)
+			for _, value := range values {
+				headers.Add(key, value)
+			}
+		}
+	}
+	if userAgent := opts.UserAgent(); userAgent != "" {
+		headers.Set("User-Agent", userAgent)
+	}
+	return headers
+}
+
+// protocolParser returns the wire parser every encode and decode goes
+// through: the Parser option when one is injected, otherwise the parser
+// matching the configured ProtocolVersion - v3 for EIO=3 compatibility mode,
+// v4 in the default case.
+func protocolParser(opts SocketOptionsInterface) parser.Parser {
+	if p := opts.Parser(); p != nil {
+		return p
+	}
+	if opts.ProtocolVersion() == 3 {
+		return parser.Parserv3()
+	}
+	return parser.Parserv4()
+}
+
+// cacheBuster generates the value of the timestamp query parameter according
+// to the configured CacheBusterStrategy. Both strategies produce URL-safe
+// strings.
+func cacheBuster(opts SocketOptionsInterface) string {
+	if opts.CacheBusterStrategy() == CacheBusterMonotonic {
+		return request.MonotonicString()
+	}
+	return request.RandomString()
+}
+
+// dialContextWithBuffers returns the dial function the TCP-based transports
+// should use: the configured NetDialContext (or the net.Dialer default),
+// wrapped so SocketReadBuffer/SocketWriteBuffer are applied to every TCP
+// connection dialed. Failures to apply a buffer size are logged and ignored -
+// the OS may clamp or refuse the value.
+func dialContextWithBuffers(opts SocketOptionsInterface) func(ctx context.Context, network string, addr string) (net.Conn, error) {
+	dial := opts.NetDialContext()
+	readBuffer, writeBuffer := opts.SocketReadBuffer(), opts.SocketWriteBuffer()
+
+	if readBuffer <= 0 && writeBuffer <= 0 {
+		return dial
+	}
+
+	if dial == nil {
+		var dialer net.Dialer
+		dial = dialer.DialContext
+	}
+
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			if readBuffer > 0 {
+				if err := tcp.SetReadBuffer(readBuffer); err != nil {
+					client_transport_log.Debug("SetReadBuffer(%d): %v", readBuffer, err)
+				}
+			}
+			if writeBuffer > 0 {
+				if err := tcp.SetWriteBuffer(writeBuffer); err != nil {
+					client_transport_log.Debug("SetWriteBuffer(%d): %v", writeBuffer, err)
+				}
+			}
+		}
+
+		return conn, nil
+	}
+}
+
+// SupportsBinary reports whether the transport may emit binary frames, i.e.
+// base64 encoding was not forced.
+func (t *transport) SupportsBinary() bool {
+	return !t.opts.ForceBase64()
+}
+
+// Open initiates the transport.
+func (t *transport) Open() Transport {
+	if t.opts.RequireBinary() && t.opts.ForceBase64() {
+		// The two options contradict each other; fail loudly rather than
+		// picking a winner.
+		t.proto.OnError("binary required", errors.New("RequireBinary and ForceBase64 are mutually exclusive"), nil)
+		return t
+	}
+
+	t.SetReadyState(TransportStateOpening)
+	t.proto.DoOpen()
+
+	return t
+}
+
+// Close tears the transport down.
+func (t *transport) Close() Transport {
+	if state := t.ReadyState(); state == TransportStateOpening || state == TransportStateOpen {
+		t.proto.DoClose()
+		t.proto.OnClose(errors.New("forced close"))
+	}
+
+	return t
+}
+
+// Send writes the packets over the transport when it is open, silently
+// discarding them otherwise.
+func (t *transport) Send(packets []*packet.Packet) {
+	if t.ReadyState() == TransportStateOpen {
+		t.proto.Write(packets)
+	} else {
+		client_transport_log.Debug("transport is not open, discarding packets")
+	}
+}
+
+// TrySend is like Send but returns ErrTransportNotOpen instead of silently
+// discarding the packets when the transport is not open, so callers can
+// decide to buffer or fail.
+func (t *transport) TrySend(packets []*packet.Packet) error {
+	if t.ReadyState() != TransportStateOpen {
+		return ErrTransportNotOpen
+	}
+
+	t.proto.Write(packets)
+
+	return nil
+}
+
+// Pause is a no-op on the base transport; polling overrides it so that
+// in-flight requests settle before an upgrade.
+func (t *transport) Pause(onPause func()) {
+	if onPause != nil {
+		onPause()
+	}
+}
+
+// CreateUri assembles the connection URI for the given scheme and query. The
+// path's trailing slash follows AddTrailingSlash: appended (never doubled)
+// when true, stripped when false.
+func (t *transport) CreateUri(schema string, query url.Values) *url.URL {
+	path := t.opts.Path()
+	if t.opts.AddTrailingSlash() {
+		if !strings.HasSuffix(path, "/") {
+			path += "/"
+		}
+	} else {
+		path = strings.TrimSuffix(path, "/")
+	}
+
+	uri := &url.URL{
+		Scheme:   schema,
+		Host:     t.hostAndPort(schema),
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+
+	return uri
+}
+
+func (t *transport) hostAndPort(schema string) string {
+	hostname := t.opts.Hostname()
+	if strings.Contains(hostname, ":") {
+		// Bracket bare IPv6 literals.
+		hostname = "[" + hostname + "]"
+	}
+
+	port := t.opts.Port()
+	if port != "" && !t.isDefaultPort(schema, port) {
+		return hostname + ":" + port
+	}
+
+	return hostname
+}
+
+func (t *transport) isDefaultPort(schema string, port string) bool {
+	switch schema {
+	case "https", "wss":
+		return port == "443"
+	case "http", "ws":
+		return port == "80"
+	}
+
+	return false
+}
+
+// OnOpen is called when the transport is open and ready to write.
+func (t *transport) OnOpen() {
+	t.SetReadyState(TransportStateOpen)
+	t.SetWritable(true)
+	t.Emit(EventOpen)
+}
+
+// OnData is called with raw data received from the wire.
+func (t *transport) OnData(data _types.BufferInterface) {
+	t.bytesReceived.Add(uint64(data.Len()))
+
+	p, err := protocolParser(t.opts).DecodePacket(data)
+	if err != nil {
+		client_transport_log.Debug("data decode error: %v", err)
+		return
+	}
+
+	t.proto.OnPacket(p)
+}
+
+// OnPacket is called with a decoded packet.
+func (t *transport) OnPacket(data *packet.Packet) {
+	t.packetsReceived.Add(1)
+	if packet.NOOP == data.Type {
+		// NOOP is a wake-up for pending polls, not application data: count
+		// it and emit "noop", but keep it out of the packet stream so
+		// application-level packet listeners never see it.
+		t.noopsReceived.Add(1)
+		t.Emit(EventNoop)
+		return
+	}
+	t.Emit(EventPacket, data)
+}
+
+// OnError emits an "error" event describing a transport failure.
+func (t *transport) OnError(reason string, description error, context any) Transport {
+	t.Emit(EventError, NewError(reason, description, context))
+
+	return t
+}
+
+// OnClose is called upon transport close with the close details. Packets of
+// the last write batch known to be unwritten are folded into a CloseDetails
+// wrapper so downstream listeners can re-queue them.
+func (t *transport) OnClose(details error) {
+	t.SetReadyState(TransportStateClosed)
+
+	if undelivered := t.Undelivered(); len(undelivered) > 0 {
+		if _, ok := details.(*CloseDetails); !ok {
+			details = &CloseDetails{Description: details, Undelivered: undelivered}
+		}
+	}
+
+	t.Emit(EventClose, details)
+}
+
+// DoOpen, DoClose and Write are implemented by the concrete transports.
+func (t *transport) DoOpen() {}
+
+func (t *transport) DoClose() {}
+
+func (t *transport) Write([]*packet.Packet) {}
@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/zishang520/engine.io/v2/types"
+)
+
+// TestTransportOptionsPrecedence builds one transport with a per-transport
+// override and one without, and checks the override wins over the global
+// options for headers, query and path - while the untouched transport keeps
+// the global values.
+func TestTransportOptionsPrecedence(t *testing.T) {
+	wsOverride := DefaultSocketOptions()
+	wsOverride.SetPath("/ws-tunnel/")
+	wsOverride.SetExtraHeaders(map[string][]string{"X-Shared": {"websocket"}})
+	wsOverride.SetQuery(url.Values{"flavor": {"websocket"}})
+
+	opts := DefaultSocketOptions()
+	opts.SetTransports(types.NewSet("polling", "websocket"))
+	opts.SetPath("/global/")
+	opts.SetExtraHeaders(map[string][]string{"X-Shared": {"global"}})
+	opts.SetQuery(url.Values{"flavor": {"global"}})
+	opts.SetTransportOptions(map[string]SocketOptionsInterface{
+		"websocket": wsOverride,
+	})
+
+	s := NewSocket(hangingServer(t), opts)
+	t.Cleanup(func() { s.Close() })
+
+	ws, err := s.CreateTransport("websocket")
+	if err != nil {
+		t.Fatalf("creating websocket transport: %v", err)
+	}
+	polling, err := s.CreateTransport("polling")
+	if err != nil {
+		t.Fatalf("creating polling transport: %v", err)
+	}
+
+	if got := ws.Opts().Path(); got != "/ws-tunnel/" {
+		t.Errorf("websocket path = %q, want the override", got)
+	}
+	if got := polling.Opts().Path(); got != "/global/" {
+		t.Errorf("polling path = %q, want the global value", got)
+	}
+
+	if got := ws.Opts().ExtraHeaders().Get("X-Shared"); got != "websocket" {
+		t.Errorf("websocket X-Shared header = %q, want the override", got)
+	}
+	if got := polling.Opts().ExtraHeaders().Get("X-Shared"); got != "global" {
+		t.Errorf("polling X-Shared header = %q, want the global value", got)
+	}
+
+	if got := ws.Query().Get("flavor"); got != "websocket" {
+		t.Errorf("websocket flavor query = %q, want the override", got)
+	}
+	if got := polling.Query().Get("flavor"); got != "global" {
+		t.Errorf("polling flavor query = %q, want the global value", got)
+	}
+
+	// The handshake parameters ride on top of whichever query won.
+	for name, transport := range map[string]Transport{"websocket": ws, "polling": polling} {
+		if got := transport.Query().Get("transport"); got != name {
+			t.Errorf("%s transport query param = %q", name, got)
+		}
+		if got := transport.Query().Get("EIO"); got != "4" {
+			t.Errorf("%s EIO query param = %q, want 4", name, got)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package engine
+
+// transports maps transport names to their constructors, in the order the
+// client tries them by default.
+var transports = map[string]func(SocketWithoutUpgrade, SocketOptionsInterface) Transport{
+	"polling": func(socket SocketWithoutUpgrade, opts SocketOptionsInterface) Transport {
+		return NewPolling(socket, opts)
+	},
+	"websocket": func(socket SocketWithoutUpgrade, opts SocketOptionsInterface) Transport {
+		return NewWebSocket(socket, opts)
+	},
+	"webtransport": func(socket SocketWithoutUpgrade, opts SocketOptionsInterface) Transport {
+		return NewWebTransport(socket, opts)
+	},
+}
+
+// Transports returns the registry of available transport constructors.
+func Transports() map[string]func(SocketWithoutUpgrade, SocketOptionsInterface) Transport {
+	return transports
+}
@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zishang520/engine.io-go-parser/packet"
+)
+
+// TestUpgradeToWebsocketPromptly runs the full polling-to-websocket upgrade
+// against the reference server and checks it settles promptly: the server's
+// NOOP kicks the paused poll loose, the websocket takes over, and traffic
+// still flows afterwards.
+func TestUpgradeToWebsocketPromptly(t *testing.T) {
+	url := newTestServer(t, nil)
+
+	var noops atomic.Int64
+	s := NewSocket(url, DefaultSocketOptions())
+	t.Cleanup(func() { s.Close() })
+	s.On(EventNoop, func(...any) { noops.Add(1) })
+
+	started := time.Now()
+	waitForEvent(t, s, EventOpen, 5*time.Second)
+	waitForEvent(t, s, EventUpgrade, 5*time.Second)
+
+	if elapsed := time.Since(started); elapsed > 3*time.Second {
+		t.Errorf("upgrade took %v, expected the NOOP to settle it promptly", elapsed)
+	}
+	if got := s.TransportName(); got != "websocket" {
+		t.Errorf("transport after upgrade = %q, want websocket", got)
+	}
+	if noops.Load() == 0 {
+		t.Errorf("no NOOP observed while pausing the polling transport")
+	}
+
+	// The upgraded transport must carry traffic as before.
+	echoRound(t, s, 2)
+}
+
+// TestPacketCreateOncePerSendAcrossUpgrade sends a stream of messages while
+// the socket upgrades underneath and checks "packetCreate" fires exactly once
+// per send: the emission sits before the packet enters the buffer, so a flush
+// replayed on the new transport must not repeat it.
+func TestPacketCreateOncePerSendAcrossUpgrade(t *testing.T) {
+	url := newTestServer(t, nil)
+
+	s := NewSocket(url, DefaultSocketOptions())
+	t.Cleanup(func() { s.Close() })
+
+	var created atomic.Int64
+	s.On(EventPacketCreate, func(args ...any) {
+		if len(args) > 0 {
+			if pkt, ok := args[0].(*packet.Packet); ok && pkt.Type == packet.MESSAGE {
+				created.Add(1)
+			}
+		}
+	})
+
+	var changesMu sync.Mutex
+	var changes []string
+	s.On(EventTransportChange, func(args ...any) {
+		if len(args) > 0 {
+			if transport, ok := args[0].(Transport); ok {
+				changesMu.Lock()
+				changes = append(changes, transport.Name())
+				changesMu.Unlock()
+			}
+		}
+	})
+
+	messages := collectMessages(s)
+	waitForEvent(t, s, EventOpen, 5*time.Second)
+
+	// Trickle sends across the upgrade window so some flush before, some
+	// queue behind the paused transport and flush again after the swap.
+	const count = 20
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for i := 0; i < count; i++ {
+			s.SendString("pc-" + strconv.Itoa(i))
+			time.Sleep(5 * time.Millisecond)
+		}
+	}()
+
+	waitForEvent(t, s, EventUpgrade, 5*time.Second)
+	<-sent
+
+	for i := 0; i < count; i++ {
+		select {
+		case <-messages:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("echo %d of %d never arrived across the upgrade", i+1, count)
+		}
+	}
+
+	if got := created.Load(); got != count {
+		t.Errorf("packetCreate fired %d times for %d sends", got, count)
+	}
+
+	changesMu.Lock()
+	defer changesMu.Unlock()
+	if len(changes) == 0 || changes[len(changes)-1] != "websocket" {
+		t.Errorf("transportChange sequence = %v, want it ending in websocket", changes)
+	}
+}
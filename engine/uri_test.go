@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"net/url"
+	"testing"
+)
+
+// TestConstructMergesURIQuery feeds a URI carrying query parameters together
+// with an explicit opts.Query() and checks the merge: URI-only parameters
+// survive, options-only parameters survive, and on a conflict the options
+// value wins.
+func TestConstructMergesURIQuery(t *testing.T) {
+	opts := DefaultSocketOptions()
+	opts.SetQuery(url.Values{
+		"shared": {"from-options"},
+		"only":   {"from-options"},
+	})
+
+	s := NewSocket(hangingServer(t)+"/custom-path/?shared=from-uri&token=abc", opts)
+	t.Cleanup(func() { s.Close() })
+
+	query := s.Opts().Query()
+	if got := query.Get("token"); got != "abc" {
+		t.Errorf("token = %q, want the URI value to survive the merge", got)
+	}
+	if got := query.Get("only"); got != "from-options" {
+		t.Errorf("only = %q, want the options value to survive the merge", got)
+	}
+	if got := query.Get("shared"); got != "from-options" {
+		t.Errorf("shared = %q, want the options value to win the conflict", got)
+	}
+	if got := s.Opts().Path(); got != "/custom-path/" {
+		t.Errorf("path = %q, want it derived from the URI", got)
+	}
+}
+
+// TestConstructDerivesLocationFromURI checks Secure/Hostname/Port/Path all
+// come out of the URI consistently; the socket never connects anywhere, the
+// host does not resolve.
+func TestConstructDerivesLocationFromURI(t *testing.T) {
+	s := NewSocket("https://example.invalid:8443/eio/?a=1", DefaultSocketOptions())
+	t.Cleanup(func() { s.Close() })
+
+	opts := s.Opts()
+	if !opts.Secure() {
+		t.Error("https URI did not mark the socket secure")
+	}
+	if got := opts.Hostname(); got != "example.invalid" {
+		t.Errorf("hostname = %q", got)
+	}
+	if got := opts.Port(); got != "8443" {
+		t.Errorf("port = %q", got)
+	}
+	if got := opts.Path(); got != "/eio/" {
+		t.Errorf("path = %q", got)
+	}
+	if got := opts.Query().Get("a"); got != "1" {
+		t.Errorf("query a = %q, want the URI parameter honored", got)
+	}
+}
@@ -0,0 +1,568 @@
+package engine
+
+import (
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	"github.com/zishang520/engine.io-go-parser/packet"
+	_types "github.com/zishang520/engine.io-go-parser/types"
+	"github.com/zishang520/engine.io/v2/log"
+)
+
+var client_websocket_log = log.NewLog("engine.io-client:websocket")
+
+// websocket is the WebSocket transport, backed by gorilla/websocket.
+type websocket struct {
+	Transport
+
+	ws *ws.Conn
+
+	// mu serializes frame writes; gorilla connections support one
+	// concurrent writer only. A channel semaphore rather than a sync.Mutex
+	// so acquisition can be bounded by WriteLockTimeout.
+	mu chan struct{}
+
+	// tokenProtocol is the token-carrying subprotocol entry offered on the
+	// last dial (see SetTokenViaSubprotocol), kept so Subprotocol can strip
+	// it from what it exposes.
+	tokenProtocol string
+
+	// writeSlots bounds the writer goroutines queued on the write lock when
+	// MaxConcurrentWrites is set; built lazily on the first asynchronous
+	// write.
+	writeSlots     chan struct{}
+	writeSlotsOnce sync.Once
+
+	// _paused stops the read loop at the next message boundary; see Pause.
+	_paused atomic.Bool
+
+	// compressedRawBytes and compressedWireBytes accumulate the payload
+	// sizes of frames written with compression on, before and after the
+	// deflate pass; see CompressionStats.
+	compressedRawBytes  atomic.Uint64
+	compressedWireBytes atomic.Uint64
+}
+
+// MakeWebSocket returns a websocket transport yet to be constructed.
+func MakeWebSocket() WebSocket {
+	w := &websocket{
+		Transport: MakeTransport(),
+
+		mu: make(chan struct{}, 1),
+	}
+
+	w.Prototype(w)
+
+	return w
+}
+
+func NewWebSocket(socket SocketWithoutUpgrade, opts SocketOptionsInterface) WebSocket {
+	w := MakeWebSocket()
+
+	w.Construct(socket, opts)
+
+	return w
+}
+
+func (w *websocket) Name() string { return "websocket" }
+
+func (w *websocket) DoOpen() {
+	protocols := w.Opts().Protocols()
+	w.tokenProtocol = ""
+	if auth := w.Opts().TokenViaSubprotocol(); auth != nil && auth.Token != nil {
+		// The token runs per attempt so rotated credentials are picked up.
+		w.tokenProtocol = auth.Prefix + auth.Token()
+		protocols = append(append([]string(nil), protocols...), w.tokenProtocol)
+	}
+
+	dialer := &ws.Dialer{
+		TLSClientConfig:   w.Opts().TLSClientConfig(),
+		HandshakeTimeout:  w.Opts().RequestTimeout(),
+		Subprotocols:      protocols,
+		EnableCompression: w.Opts().PerMessageDeflate() != nil,
+		NetDialContext:    dialContextWithBuffers(w.Opts()),
+	}
+
+	// A user-supplied NetDial routes the handshake over an existing
+	// connection (SSH tunnel, in-memory pipe). NetDialContext would win
+	// inside gorilla's dialer, so it is dropped in that case.
+	if netDial := w.Opts().NetDial(); netDial != nil {
+		dialer.NetDial = netDial
+		dialer.NetDialContext = nil
+	}
+
+	headers := requestHeaders(w.Opts())
+
+	conn, res, err := dialer.DialContext(w.Socket().Context(), w.uri().String(), headers)
+	if err != nil {
+		w.OnError("websocket error", err, nil)
+		return
+	}
+
+	if res != nil {
+		notifyHandshakeResponse(w, res.Header)
+	}
+
+	// A server echoing a subprotocol we never offered is misbehaving (or a
+	// gateway rewrote the handshake); with a token in play that would mean
+	// the authorization was not actually accepted.
+	if w.tokenProtocol != "" {
+		if negotiated := conn.Subprotocol(); negotiated != "" && negotiated != w.tokenProtocol && !contains(w.Opts().Protocols(), negotiated) {
+			conn.Close()
+			w.OnError("websocket error", fmt.Errorf("server selected unoffered subprotocol %q", negotiated), nil)
+			return
+		}
+	}
+
+	w.ws = conn
+
+	go w._init()
+
+	w.OnOpen()
+}
+
+// Subprotocol returns the subprotocol the server selected on the dial, ""
+// when none was negotiated or the transport is not connected. A token entry
+// injected via SetTokenViaSubprotocol is reported as "" instead, so the
+// credential cannot leak into logs.
+func (w *websocket) Subprotocol() string {
+	if w.ws == nil {
+		return ""
+	}
+	negotiated := w.ws.Subprotocol()
+	if w.tokenProtocol != "" && negotiated == w.tokenProtocol {
+		return ""
+	}
+	return negotiated
+}
+
+func contains(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Pause holds the transport while the socket upgrades away from websocket
+// (say, to webtransport), mirroring the polling behavior: the read loop stops
+// cleanly at the next message boundary, the transport is marked non-writable,
+// and onPause runs once any in-flight write batch has drained.
+func (w *websocket) Pause(onPause func()) {
+	w.SetReadyState(TransportStatePausing)
+	w._paused.Store(true)
+
+	pause := func() {
+		client_websocket_log.Debug("paused")
+		w.SetReadyState(TransportStatePaused)
+		if onPause != nil {
+			onPause()
+		}
+	}
+
+	if !w.Writable() {
+		client_websocket_log.Debug("we are currently writing - waiting to pause")
+		w.Once(EventDrain, func(...any) {
+			pause()
+		})
+		return
+	}
+
+	w.SetWritable(false)
+	pause()
+}
+
+// _init runs the read loop until the connection dies or the transport is
+// paused. With a ReadErrorPolicy configured, read errors the policy marks
+// recoverable keep the loop alive, up to MaxConsecutiveReadErrors in a row.
+func (w *websocket) _init() {
+	consecutiveErrors := 0
+
+	for {
+		if w._paused.Load() {
+			client_websocket_log.Debug("read loop stopping - transport paused")
+			return
+		}
+
+		messageType, message, err := w.ws.ReadMessage()
+		if err != nil {
+			// A proper close frame carries a code and reason worth keeping:
+			// a listener deciding whether to reconnect wants to tell a
+			// normal 1000 from a 1011 server error.
+			var closeErr *ws.CloseError
+			if errors.As(err, &closeErr) {
+				w.OnClose(&CloseInfo{Code: closeErr.Code, Reason: closeErr.Text, Err: err})
+				return
+			}
+			if policy := w.Opts().ReadErrorPolicy(); policy != nil && policy(err) {
+				consecutiveErrors++
+				if consecutiveErrors <= w.Opts().MaxConsecutiveReadErrors() {
+					client_websocket_log.Debug("recoverable read error (%d in a row) - continuing: %v", consecutiveErrors, err)
+					continue
+				}
+				client_websocket_log.Debug("recoverable read error limit reached - giving up: %v", err)
+			}
+			w.OnError("websocket error", err, nil)
+			return
+		}
+
+		consecutiveErrors = 0
+
+		w.CountWireBytes(0, websocketFrameSize(len(message), false))
+
+		switch messageType {
+		case ws.BinaryMessage:
+			w.OnData(_types.NewBytesBuffer(message))
+		case ws.TextMessage:
+			// Each websocket message carries exactly one packet, so a text
+			// frame not starting with a packet type is framing from another
+			// transport leaking through (proxy rewriting); flag it before
+			// the decoder fails mysteriously.
+			if len(message) > 0 && !packetLeadByte(message[0]) {
+				err := fmt.Errorf("message does not look like a websocket-framed packet (first byte 0x%02x)", message[0])
+				client_websocket_log.Debug("transport mismatch: %v", err)
+				w.Emit(EventTransportMismatch, err)
+			}
+			w.OnData(_types.NewStringBufferString(string(message)))
+		}
+	}
+}
+
+func (w *websocket) Write(packets []*packet.Packet) {
+	w.SetWritable(false)
+
+	// With SynchronousWrites the frames go out inline on the calling
+	// goroutine; otherwise a writer goroutine takes over so Send never
+	// blocks the caller. Either way the mutex keeps concurrent batches
+	// ordered on the wire.
+	if w.Opts().SynchronousWrites() {
+		w.writePackets(packets)
+		return
+	}
+
+	// MaxConcurrentWrites caps how many of those writer goroutines a flood
+	// of Sends may stack up on the lock. At the cap the BlockOnBufferFull
+	// policy applies: block the caller until a slot frees, or fail the
+	// batch.
+	if limit := w.Opts().MaxConcurrentWrites(); limit > 0 {
+		w.writeSlotsOnce.Do(func() { w.writeSlots = make(chan struct{}, limit) })
+
+		if w.Opts().BlockOnBufferFull() {
+			w.writeSlots <- struct{}{}
+		} else {
+			select {
+			case w.writeSlots <- struct{}{}:
+			default:
+				err := errors.New("too many concurrent writes")
+				w.SetUndelivered(packets)
+				client_websocket_log.Debug("write rejected: %v", err)
+				w.OnError("websocket write error", err, nil)
+				w.SetWritable(true)
+				w.Emit(EventDrain, err)
+				return
+			}
+		}
+
+		go func() {
+			defer func() { <-w.writeSlots }()
+			w.writePackets(packets)
+		}()
+		return
+	}
+
+	go w.writePackets(packets)
+}
+
+// lock acquires the write lock, giving up after timeout when one is
+// configured. It reports whether the lock was acquired.
+func (w *websocket) lock(timeout time.Duration) bool {
+	if timeout <= 0 {
+		w.mu <- struct{}{}
+		return true
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case w.mu <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (w *websocket) unlock() { <-w.mu }
+
+func (w *websocket) writePackets(packets []*packet.Packet) {
+	var batchErr error
+	defer func() {
+		// The batch is settled either way; report the outcome on the drain
+		// event so the socket can fire the write callbacks accordingly.
+		w.SetWritable(true)
+		if batchErr != nil {
+			w.Emit(EventDrain, batchErr)
+		} else {
+			w.Emit(EventDrain)
+		}
+	}()
+
+	if !w.lock(w.Opts().WriteLockTimeout()) {
+		// A previous write is wedged; fail the batch and tear the
+		// connection down rather than queuing on the lock forever.
+		batchErr = errors.New("write lock timeout")
+		w.SetUndelivered(packets)
+		w.OnError("websocket write error", batchErr, nil)
+		w.Close()
+		return
+	}
+	defer w.unlock()
+
+	for i, pkt := range packets {
+		data, err := protocolParser(w.Opts()).EncodePacket(pkt, w.SupportsBinary())
+		if err != nil {
+			batchErr = err
+			w.SetUndelivered(packets[i:])
+			client_websocket_log.Debug("websocket encode error: %v", err)
+			return
+		}
+
+		if err := w.doWrite(pkt, data); err != nil {
+			// The errored frame itself is ambiguous; only what follows is
+			// certainly unwritten.
+			batchErr = err
+			w.SetUndelivered(packets[i+1:])
+			w.OnError("websocket write error", err, nil)
+			return
+		}
+	}
+
+	w.SetUndelivered(nil)
+}
+
+func (w *websocket) doWrite(pkt *packet.Packet, data _types.BufferInterface) error {
+	compress := false
+	if pkt.Options != nil && pkt.Options.Compress {
+		compress = true
+	}
+	if deflate := w.Opts().PerMessageDeflate(); deflate != nil && data.Len() < deflate.Threshold {
+		compress = false
+	}
+	w.ws.EnableWriteCompression(compress)
+
+	messageType := ws.TextMessage
+	if _, ok := data.(*_types.StringBuffer); !ok {
+		messageType = ws.BinaryMessage
+	}
+
+	timeout := w.Opts().RequestTimeout()
+	if lockTimeout := w.Opts().WriteLockTimeout(); lockTimeout > 0 && (timeout == 0 || lockTimeout < timeout) {
+		timeout = lockTimeout
+	}
+	if timeout > 0 {
+		if err := w.ws.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+			return err
+		}
+	}
+
+	payload := data.Bytes()
+	if err := w.ws.WriteMessage(messageType, payload); err != nil {
+		return err
+	}
+
+	if compress {
+		w.compressedRawBytes.Add(uint64(len(payload)))
+		w.compressedWireBytes.Add(deflatedSize(payload))
+	}
+
+	// Client-to-server frames are masked.
+	w.CountWireBytes(websocketFrameSize(len(payload), true), 0)
+	w.CountSent(1, websocketFrameSize(len(payload), true))
+
+	return nil
+}
+
+// CompressionStats reports how many payload bytes were written with
+// permessage-deflate active, before and after compression, accumulated over
+// the transport's lifetime. Dividing the two gives the ratio the actual
+// traffic achieved - the number to weigh against the deflate CPU cost.
+// Frames below the PerMessageDeflate threshold go out uncompressed and are
+// not counted.
+func (w *websocket) CompressionStats() (rawBytes, compressedBytes uint64) {
+	return w.compressedRawBytes.Load(), w.compressedWireBytes.Load()
+}
+
+// countingWriter counts the bytes written through it and discards them.
+type countingWriter struct{ n uint64 }
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += uint64(len(p))
+	return len(p), nil
+}
+
+// deflatedSize reports the on-wire payload size of a compressed frame by
+// repeating the deflate pass gorilla applies - its default level, no context
+// takeover - onto a counting writer, since the library does not surface what
+// it actually wrote. Per RFC 7692 the trailing empty-block marker is stripped
+// from the frame, hence the 4-byte correction.
+func deflatedSize(payload []byte) uint64 {
+	var counter countingWriter
+	fw, err := flate.NewWriter(&counter, 1)
+	if err != nil {
+		return uint64(len(payload))
+	}
+	if _, err := fw.Write(payload); err != nil {
+		return uint64(len(payload))
+	}
+	if err := fw.Flush(); err != nil {
+		return uint64(len(payload))
+	}
+	if counter.n >= 4 {
+		counter.n -= 4
+	}
+	return counter.n
+}
+
+// streamChunkSize is the copy buffer of SendStream; each fill is written as a
+// fragment of the same websocket message, so the payload never has to be
+// materialized.
+const streamChunkSize = 32 * 1024
+
+// SendStream writes one binary message of the given size in chunks read from
+// data. Protocol v4 frames binary payloads without a header, so the raw bytes
+// stream out as a single MESSAGE. The write lock is held for the whole copy -
+// concurrent batches queue behind it - and the write deadline is refreshed
+// per chunk, so a slow reader cannot trip a deadline sized for whole frames.
+// A mid-stream failure is fatal for the message framing and closes the
+// transport.
+func (w *websocket) SendStream(data io.Reader, size int64) error {
+	if TransportStateOpen != w.ReadyState() {
+		return ErrTransportNotOpen
+	}
+
+	if !w.lock(w.Opts().WriteLockTimeout()) {
+		err := errors.New("write lock timeout")
+		w.OnError("websocket write error", err, nil)
+		w.Close()
+		return err
+	}
+	defer w.unlock()
+
+	// Compression would buffer the payload; streaming keeps it off.
+	w.ws.EnableWriteCompression(false)
+
+	writer, err := w.ws.NextWriter(ws.BinaryMessage)
+	if err != nil {
+		w.OnError("websocket write error", err, nil)
+		return err
+	}
+
+	timeout := w.Opts().RequestTimeout()
+	buffer := make([]byte, streamChunkSize)
+	written := int64(0)
+	for {
+		n, readErr := data.Read(buffer)
+		if n > 0 {
+			if timeout > 0 {
+				if err := w.ws.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+					writer.Close()
+					w.OnError("websocket write error", err, nil)
+					return err
+				}
+			}
+			if _, err := writer.Write(buffer[:n]); err != nil {
+				writer.Close()
+				w.OnError("websocket write error", err, nil)
+				return err
+			}
+			written += int64(n)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			// The message is part-written and cannot be completed; the
+			// connection is unusable for further framing.
+			writer.Close()
+			w.OnError("websocket write error", readErr, nil)
+			w.Close()
+			return readErr
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		w.OnError("websocket write error", err, nil)
+		return err
+	}
+
+	if written != size {
+		client_websocket_log.Debug("stream size mismatch: announced %d, read %d", size, written)
+	}
+
+	w.CountWireBytes(websocketFrameSize(int(written), true), 0)
+	w.CountSent(1, websocketFrameSize(int(written), true))
+
+	return nil
+}
+
+func (w *websocket) DoClose() {
+	if w.ws != nil {
+		// The polite close frame waits for the write lock, bounded by the
+		// close timeout (or the write lock timeout) so a wedged writer
+		// cannot stall the teardown; the hard close below runs regardless.
+		// With neither timeout configured the lock is only tried, never
+		// waited on - an unbounded wait here would let a stuck write block
+		// the teardown forever.
+		timeout := w.Opts().CloseTimeout()
+		if timeout <= 0 {
+			timeout = w.Opts().WriteLockTimeout()
+		}
+		locked := false
+		if timeout > 0 {
+			locked = w.lock(timeout)
+		} else {
+			select {
+			case w.mu <- struct{}{}:
+				locked = true
+			default:
+			}
+		}
+		if locked {
+			w.ws.WriteMessage(ws.CloseMessage, ws.FormatCloseMessage(ws.CloseNormalClosure, ""))
+			w.unlock()
+		} else {
+			client_websocket_log.Debug("close frame skipped - write lock busy")
+		}
+		w.ws.Close()
+	}
+}
+
+func (w *websocket) uri() *url.URL {
+	schema := "ws"
+	if w.Opts().Secure() {
+		schema = "wss"
+	}
+
+	query := url.Values{}
+	for key, values := range w.Query() {
+		query[key] = values
+	}
+
+	if w.Opts().TimestampRequests() {
+		query.Set(w.Opts().TimestampParam(), cacheBuster(w.Opts()))
+	}
+
+	if !w.SupportsBinary() {
+		query.Set("b64", "1")
+	}
+
+	return w.CreateUri(schema, query)
+}
@@ -0,0 +1,328 @@
+package engine
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+
+	"github.com/quic-go/quic-go/http3"
+	wt "github.com/quic-go/webtransport-go"
+	"github.com/zishang520/engine.io-go-parser/packet"
+	_types "github.com/zishang520/engine.io-go-parser/types"
+	"github.com/zishang520/engine.io/v2/log"
+)
+
+var client_webtransport_log = log.NewLog("engine.io-client:webtransport")
+
+const (
+	webTransportFrameText   byte = 0x00
+	webTransportFrameBinary byte = 0x01
+)
+
+// datagramConn is the subset of the QUIC connection carrying RFC 9221
+// datagrams. webtransport-go does not surface the channel on the Session at
+// this version, so the connection is recovered from the hijacked HTTP/3
+// response instead.
+type datagramConn interface {
+	SendDatagram([]byte) error
+	ReceiveDatagram(context.Context) ([]byte, error)
+}
+
+// webTransport carries the Engine.IO stream over a WebTransport session. Each
+// packet travels on the session's bidirectional stream behind a small frame
+// header (1-byte text/binary flag, 3-byte big-endian length). When the
+// session negotiates the datagram extension the unreliable channel is exposed
+// as well, see SendPacketDatagram.
+type webTransport struct {
+	Transport
+
+	session   *wt.Session
+	stream    wt.Stream
+	datagrams datagramConn
+
+	// mu serializes frame writes on the stream.
+	mu sync.Mutex
+}
+
+// MakeWebTransport returns a webtransport transport yet to be constructed.
+func MakeWebTransport() WebTransport {
+	w := &webTransport{
+		Transport: MakeTransport(),
+	}
+
+	w.Prototype(w)
+
+	return w
+}
+
+func NewWebTransport(socket SocketWithoutUpgrade, opts SocketOptionsInterface) WebTransport {
+	w := MakeWebTransport()
+
+	w.Construct(socket, opts)
+
+	return w
+}
+
+func (w *webTransport) Name() string { return "webtransport" }
+
+func (w *webTransport) DoOpen() {
+	dialer := &wt.Dialer{
+		RoundTripper: &http3.RoundTripper{
+			TLSClientConfig: w.Opts().TLSClientConfig(),
+			EnableDatagrams: true,
+		},
+	}
+
+	headers := requestHeaders(w.Opts())
+
+	ctx := w.Socket().Context()
+
+	rsp, session, err := dialer.Dial(ctx, w.uri().String(), headers)
+	if err != nil {
+		w.OnError("webtransport error", err, nil)
+		return
+	}
+
+	if rsp != nil {
+		notifyHandshakeResponse(w, rsp.Header)
+	}
+
+	stream, err := session.OpenStreamSync(ctx)
+	if err != nil {
+		session.CloseWithError(0, "stream error")
+		w.OnError("webtransport error", err, nil)
+		return
+	}
+
+	w.session = session
+	w.stream = stream
+
+	// The datagram channel lives on the QUIC connection, which the session
+	// does not expose; dig it out of the hijacked HTTP/3 response.
+	if session.ConnectionState().SupportsDatagrams {
+		if hijacker, ok := rsp.Body.(http3.Hijacker); ok {
+			w.datagrams, _ = hijacker.StreamCreator().(datagramConn)
+		}
+	}
+
+	go w._init()
+	if w.datagrams != nil {
+		go w._readDatagrams()
+	}
+
+	w.OnOpen()
+}
+
+// _readDatagrams runs the receive loop of the unreliable channel, emitting a
+// "datagram" event with the raw payload of every datagram. The loop ends
+// with the session, whose close already drives the transport teardown.
+func (w *webTransport) _readDatagrams() {
+	ctx := w.Socket().Context()
+	for {
+		data, err := w.datagrams.ReceiveDatagram(ctx)
+		if err != nil {
+			client_webtransport_log.Debug("datagram receive loop ended: %v", err)
+			return
+		}
+
+		w.CountWireBytes(0, uint64(len(data)))
+		w.Emit(EventDatagram, data)
+	}
+}
+
+// _init runs the read loop over the bidirectional stream.
+func (w *webTransport) _init() {
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(w.stream, header); err != nil {
+			w.OnClose(err)
+			return
+		}
+
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(w.stream, payload); err != nil {
+			w.OnClose(err)
+			return
+		}
+
+		w.CountWireBytes(0, uint64(len(header)+len(payload)))
+
+		switch header[0] {
+		case webTransportFrameBinary:
+			w.OnData(_types.NewBytesBuffer(payload))
+		default:
+			w.OnData(_types.NewStringBufferString(string(payload)))
+		}
+	}
+}
+
+func (w *webTransport) Write(packets []*packet.Packet) {
+	w.SetWritable(false)
+
+	go func() {
+		var batchErr error
+		defer func() {
+			// The batch is settled either way; report the outcome on the
+			// drain event so the socket can fire the write callbacks
+			// accordingly.
+			w.SetWritable(true)
+			if batchErr != nil {
+				w.Emit(EventDrain, batchErr)
+			} else {
+				w.Emit(EventDrain)
+			}
+		}()
+
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		routing := w.Opts().WebTransportRouting()
+
+		for i, pkt := range packets {
+			data, err := protocolParser(w.Opts()).EncodePacket(pkt, w.SupportsBinary())
+			if err != nil {
+				batchErr = err
+				w.SetUndelivered(packets[i:])
+				client_webtransport_log.Debug("webtransport encode error: %v", err)
+				return
+			}
+
+			// The routing policy may divert a packet onto the unreliable
+			// datagram channel; a failed datagram send (not negotiated,
+			// frame too large) falls back to the stream below.
+			if routing != nil && w.datagrams != nil && routing(pkt) {
+				if err := w.writeDatagramFrame(data); err == nil {
+					continue
+				} else {
+					client_webtransport_log.Debug("datagram routing failed, falling back to stream: %v", err)
+				}
+			}
+
+			if err := w.doWrite(data); err != nil {
+				// The errored frame itself is ambiguous; only what follows
+				// is certainly unwritten.
+				batchErr = err
+				w.SetUndelivered(packets[i+1:])
+				w.OnError("webtransport write error", err, nil)
+				return
+			}
+		}
+
+		w.SetUndelivered(nil)
+	}()
+}
+
+func (w *webTransport) doWrite(data _types.BufferInterface) error {
+	flag := webTransportFrameText
+	if _, ok := data.(*_types.StringBuffer); !ok {
+		flag = webTransportFrameBinary
+	}
+
+	payload := data.Bytes()
+
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(payload)))
+	length[0] = flag
+
+	if _, err := w.stream.Write(length[:]); err != nil {
+		return err
+	}
+	if _, err := w.stream.Write(payload); err != nil {
+		return err
+	}
+
+	w.CountWireBytes(uint64(len(length)+len(payload)), 0)
+	w.CountSent(1, uint64(len(length)+len(payload)))
+
+	return nil
+}
+
+// SupportsDatagrams reports whether the session negotiated the datagram
+// extension. It stays false until the transport is open.
+func (w *webTransport) SupportsDatagrams() bool {
+	return w.datagrams != nil
+}
+
+// SendDatagram sends data as one unreliable datagram alongside the ordered
+// Engine.IO stream. Delivery is best-effort: datagrams may be dropped or
+// reordered. It fails with a descriptive error when the channel was not
+// negotiated or when data exceeds the session's datagram size limit.
+func (w *webTransport) SendDatagram(data []byte) error {
+	if w.datagrams == nil {
+		return errors.New("webtransport datagrams not negotiated")
+	}
+
+	if err := w.datagrams.SendDatagram(data); err != nil {
+		return fmt.Errorf("webtransport datagram of %d bytes not sent: %w", len(data), err)
+	}
+
+	w.CountWireBytes(uint64(len(data)), 0)
+
+	return nil
+}
+
+// SendPacketDatagram sends a single encoded packet on the unreliable datagram
+// channel, framed like the stream packets so the peer can tell text from
+// binary. Delivery is best-effort: datagrams may be dropped or reordered, and
+// sending fails when the frame exceeds the session's datagram size limit.
+func (w *webTransport) SendPacketDatagram(pkt *packet.Packet) error {
+	if w.datagrams == nil {
+		return errors.New("webtransport datagrams not negotiated")
+	}
+
+	data, err := protocolParser(w.Opts()).EncodePacket(pkt, w.SupportsBinary())
+	if err != nil {
+		return err
+	}
+
+	return w.writeDatagramFrame(data)
+}
+
+// writeDatagramFrame sends one encoded packet on the datagram channel, framed
+// like the stream packets so the peer can tell text from binary.
+func (w *webTransport) writeDatagramFrame(data _types.BufferInterface) error {
+	flag := webTransportFrameText
+	if _, ok := data.(*_types.StringBuffer); !ok {
+		flag = webTransportFrameBinary
+	}
+
+	payload := data.Bytes()
+
+	frame := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(frame[:4], uint32(len(payload)))
+	frame[0] = flag
+	copy(frame[4:], payload)
+
+	if err := w.datagrams.SendDatagram(frame); err != nil {
+		return err
+	}
+
+	w.CountWireBytes(uint64(len(frame)), 0)
+	w.CountSent(1, uint64(len(frame)))
+
+	return nil
+}
+
+func (w *webTransport) DoClose() {
+	if w.session != nil {
+		w.session.CloseWithError(0, "")
+	}
+}
+
+func (w *webTransport) uri() *url.URL {
+	query := url.Values{}
+	for key, values := range w.Query() {
+		query[key] = values
+	}
+
+	if w.Opts().TimestampRequests() {
+		query.Set(w.Opts().TimestampParam(), cacheBuster(w.Opts()))
+	}
+
+	return w.CreateUri("https", query)
+}
@@ -0,0 +1,83 @@
+// Package enginereplay reads captures written by engine.Recorder and
+// re-drives a socket's decode paths from them, so a protocol-level bug report
+// carrying a capture can be replayed in tests without the server that
+// produced it.
+package enginereplay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/zishang520/engine.io-go-parser/packet"
+	_types "github.com/zishang520/engine.io-go-parser/types"
+
+	"github.com/zishang520/engine.io-client/engine"
+)
+
+// Read parses an NDJSON capture into its records, in capture order. Blank
+// lines are skipped; a malformed line fails the whole read.
+func Read(r io.Reader) ([]*engine.ReplayRecord, error) {
+	records := []*engine.ReplayRecord{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		record := &engine.ReplayRecord{}
+		if err := json.Unmarshal(line, record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
+
+// Packet rebuilds the Engine.IO packet described by a packet record, or nil
+// when the record is of another kind or its payload was not captured (size
+// recorded but IncludePayloads was off - a hash cannot be decoded).
+func Packet(record *engine.ReplayRecord) *packet.Packet {
+	if record == nil || record.Kind != engine.RecordKindPacket {
+		return nil
+	}
+	if record.Payload == nil && record.Size > 0 {
+		return nil
+	}
+
+	pkt := &packet.Packet{Type: packet.Type(record.PacketType)}
+	if record.Payload != nil {
+		if record.Binary {
+			pkt.Data = _types.NewBytesBuffer(record.Payload)
+		} else {
+			pkt.Data = _types.NewStringBufferString(string(record.Payload))
+		}
+	}
+
+	return pkt
+}
+
+// DrivePackets feeds the capture's inbound packets through the socket's
+// packet handler - the same entry point the live transports use - and returns
+// how many were replayed. Records without a replayable payload are skipped;
+// take captures with IncludePayloads set when replay is the goal.
+func DrivePackets(socket engine.SocketWithoutUpgrade, records []*engine.ReplayRecord) int {
+	driven := 0
+	for _, record := range records {
+		if record == nil || record.Direction != engine.RecordDirectionIn {
+			continue
+		}
+		pkt := Packet(record)
+		if pkt == nil {
+			continue
+		}
+		socket.OnPacket(pkt)
+		driven++
+	}
+
+	return driven
+}
@@ -0,0 +1,325 @@
+// Package request is a small HTTP helper shared by the polling transport: an
+// http.Client with a cookie jar (for sticky-session load balancers) and a
+// per-request options struct.
+package request
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Options carries the per-request knobs accepted by HTTPClient.
+type Options struct {
+	// Headers are added to the request before it is sent.
+	Headers http.Header
+
+	// Body is the request body, if any.
+	Body io.Reader
+
+	// Timeout bounds this single request, overriding the client default
+	// when non-zero.
+	Timeout time.Duration
+
+	// Context cancels the request when done; context.Background() when nil.
+	Context context.Context
+
+	// Retries is the number of additional attempts made when the request
+	// fails at the network level, before any response arrives. Attempts
+	// with a body are only retried when Body is nil or seekable. Zero
+	// disables retrying.
+	Retries int
+
+	// OnRetry, when set, is called before each retry with the 1-based
+	// attempt number and the error that caused it.
+	OnRetry func(attempt int, err error)
+
+	// OnRedirect, when set, is called for every redirect the client
+	// follows, with the upcoming request and the chain so far.
+	OnRedirect func(req *http.Request, via []*http.Request)
+
+	// OnConnectionReuse, when set, is called once a connection has been
+	// picked for the request, reporting whether an idle one was reused.
+	OnConnectionReuse func(reused bool)
+
+	// Interceptor, when set, is called with the assembled request just
+	// before it is sent (and again before each retry). It may modify the
+	// request in place; a non-nil error aborts the request.
+	Interceptor func(*http.Request) error
+}
+
+// HTTPClient wraps http.Client with a cookie jar and per-request timeouts.
+type HTTPClient struct {
+	*http.Client
+}
+
+// redirectCallbackKey carries the per-request OnRedirect callback through the
+// request context to the client's shared CheckRedirect hook.
+type redirectCallbackKey struct{}
+
+// NewHTTPClient builds a client around the given transport. A cookie jar is
+// always installed so session affinity cookies survive across requests.
+func NewHTTPClient(transport http.RoundTripper, timeout time.Duration) *HTTPClient {
+	jar, _ := cookiejar.New(nil)
+
+	return &HTTPClient{
+		Client: &http.Client{
+			Jar:       jar,
+			Transport: transport,
+			Timeout:   timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if fn, ok := req.Context().Value(redirectCallbackKey{}).(func(*http.Request, []*http.Request)); ok {
+					fn(req, via)
+				}
+				if len(via) >= 10 {
+					return errors.New("stopped after 10 redirects")
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// ClearCookies expires every cookie the jar would send with a request to u,
+// removing them from the jar. The standard jar offers no deletion API, so the
+// cookies are overwritten with already-expired replacements.
+func (c *HTTPClient) ClearCookies(u *url.URL) {
+	jar := c.Jar
+	if jar == nil || u == nil {
+		return
+	}
+
+	var expired []*http.Cookie
+	for _, cookie := range jar.Cookies(u) {
+		expired = append(expired, &http.Cookie{
+			Name:   cookie.Name,
+			Value:  "",
+			Path:   "/",
+			MaxAge: -1,
+		})
+	}
+	jar.SetCookies(u, expired)
+}
+
+// do sends one request described by opts, retrying network-level failures up
+// to opts.Retries times. A failure after the response headers arrived is not
+// retried.
+func (c *HTTPClient) do(ctx context.Context, method string, url string, opts *Options) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, url, opts.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		for key, values := range opts.Headers {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+
+		if opts.OnRedirect != nil {
+			req = req.WithContext(context.WithValue(req.Context(), redirectCallbackKey{}, opts.OnRedirect))
+		}
+		if onReuse := opts.OnConnectionReuse; onReuse != nil {
+			req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+				GotConn: func(info httptrace.GotConnInfo) { onReuse(info.Reused) },
+			}))
+		}
+
+		if opts.Interceptor != nil {
+			if err := opts.Interceptor(req); err != nil {
+				return nil, err
+			}
+		}
+
+		res, err := c.Do(req)
+		if err == nil {
+			return res, nil
+		}
+
+		if attempt >= opts.Retries || ctx.Err() != nil || !rewindBody(opts) {
+			return nil, err
+		}
+
+		if opts.OnRetry != nil {
+			opts.OnRetry(attempt+1, err)
+		}
+	}
+}
+
+// rewindBody resets opts.Body for another attempt. A nil body needs no
+// rewinding; a seekable one is rewound in place; anything else has been
+// consumed and cannot be retried.
+func rewindBody(opts *Options) bool {
+	if opts.Body == nil {
+		return true
+	}
+	if seeker, ok := opts.Body.(io.Seeker); ok {
+		_, err := seeker.Seek(0, io.SeekStart)
+		return err == nil
+	}
+	return false
+}
+
+// Request performs an HTTP request described by opts and buffers the
+// response.
+func (c *HTTPClient) Request(method string, url string, opts *Options) (*Response, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var cancel context.CancelFunc
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	res, err := c.do(ctx, method, url, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{Response: res, data: data}, nil
+}
+
+// Stream performs an HTTP request and returns as soon as the response
+// headers arrive, leaving the body to be read incrementally. The caller must
+// Close the response. The per-request Timeout is ignored - a deadline would
+// cut the stream short - so bound the request with ctx instead; the client
+// default timeout, when set, still applies.
+func (c *HTTPClient) Stream(ctx context.Context, method string, url string, opts *Options) (*StreamingResponse, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if ctx == nil {
+		ctx = opts.Context
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	res, err := c.do(ctx, method, url, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StreamingResponse{Response: res}, nil
+}
+
+// Get performs a GET request.
+func (c *HTTPClient) Get(url string, opts *Options) (*Response, error) {
+	return c.Request(http.MethodGet, url, opts)
+}
+
+// Post performs a POST request.
+func (c *HTTPClient) Post(url string, opts *Options) (*Response, error) {
+	return c.Request(http.MethodPost, url, opts)
+}
+
+// Response is a fully-buffered HTTP response.
+type Response struct {
+	*http.Response
+
+	data []byte
+}
+
+// Data returns the buffered response body.
+func (r *Response) Data() []byte {
+	return r.data
+}
+
+// OK reports whether the response carries a 2xx status.
+func (r *Response) OK() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// StreamingResponse is an HTTP response whose body has not been buffered:
+// headers and status are available immediately while Body streams the rest.
+type StreamingResponse struct {
+	*http.Response
+}
+
+// OK reports whether the response carries a 2xx status.
+func (r *StreamingResponse) OK() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// Close discards the body and releases the underlying connection.
+func (r *StreamingResponse) Close() error {
+	return r.Body.Close()
+}
+
+const alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz-_"
+
+var (
+	randomMu   sync.Mutex
+	randomPrev string
+	randomSeed uint64
+)
+
+// RandomString returns a short, URL-safe, time-ordered string suitable as a
+// cache-busting query value, following the "yeast" scheme used by the
+// JavaScript client.
+func RandomString() string {
+	randomMu.Lock()
+	defer randomMu.Unlock()
+
+	now := encode(uint64(time.Now().UnixMilli()))
+	if now != randomPrev {
+		randomSeed = 0
+		randomPrev = now
+		return now
+	}
+
+	randomSeed++
+	return now + "." + encode(randomSeed)
+}
+
+var (
+	monotonicCounter atomic.Uint64
+	monotonicOnce    sync.Once
+)
+
+// MonotonicString returns a strictly increasing, URL-safe string, for
+// cache-busting query values when a proxy only honors predictable,
+// ever-growing busters. Encoded with the same alphabet as RandomString.
+// The counter is seeded from the wall clock - like the yeast scheme - so a
+// restarted process never replays values an upstream cache may still hold.
+func MonotonicString() string {
+	monotonicOnce.Do(func() {
+		// Shifted to leave ~1M increments per elapsed millisecond; a later
+		// start always seeds past anything a previous run counted up to.
+		monotonicCounter.Store(uint64(time.Now().UnixMilli()) << 20)
+	})
+	return encode(monotonicCounter.Add(1))
+}
+
+func encode(num uint64) string {
+	encoded := ""
+	for {
+		encoded = string(alphabet[num%uint64(len(alphabet))]) + encoded
+		num /= uint64(len(alphabet))
+		if num == 0 {
+			return encoded
+		}
+	}
+}
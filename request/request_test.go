@@ -0,0 +1,309 @@
+package request
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newClient() *HTTPClient {
+	return NewHTTPClient(nil, 10*time.Second)
+}
+
+func TestRequestBuffersBodyAndCookies(t *testing.T) {
+	var gotCookie atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("session"); err == nil && cookie.Value == "abc" {
+			gotCookie.Store(true)
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+		body, _ := io.ReadAll(r.Body)
+		w.Write(append([]byte("echo:"), body...))
+	}))
+	defer ts.Close()
+
+	client := newClient()
+
+	res, err := client.Post(ts.URL, &Options{Body: strings.NewReader("ping")})
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	if !res.OK() || string(res.Data()) != "echo:ping" {
+		t.Fatalf("unexpected response: status=%d data=%q", res.StatusCode, res.Data())
+	}
+
+	// The jar must replay the session cookie on the next request.
+	if _, err := client.Get(ts.URL, nil); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !gotCookie.Load() {
+		t.Error("session cookie was not sent back on the second request")
+	}
+}
+
+func TestRequestRetriesNetworkFailures(t *testing.T) {
+	var hits atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) < 3 {
+			if hijacker, ok := w.(http.Hijacker); ok {
+				if conn, _, err := hijacker.Hijack(); err == nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("finally"))
+	}))
+	defer ts.Close()
+
+	var retries []int
+	client := newClient()
+	res, err := client.Post(ts.URL, &Options{
+		Body:    bytes.NewReader([]byte("payload")), // seekable, so retryable
+		Retries: 3,
+		OnRetry: func(attempt int, err error) {
+			retries = append(retries, attempt)
+		},
+	})
+	if err != nil {
+		t.Fatalf("post with retries: %v", err)
+	}
+	if string(res.Data()) != "finally" {
+		t.Fatalf("unexpected response %q", res.Data())
+	}
+	if len(retries) == 0 {
+		t.Error("OnRetry was never invoked")
+	}
+}
+
+func TestRequestDoesNotRetryUnseekableBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+			}
+		}
+	}))
+	defer ts.Close()
+
+	var retried atomic.Bool
+	_, err := newClient().Post(ts.URL, &Options{
+		Body:    io.MultiReader(strings.NewReader("consumed")), // not a Seeker
+		Retries: 2,
+		OnRetry: func(int, error) { retried.Store(true) },
+	})
+	if err == nil {
+		t.Fatal("expected the request to fail")
+	}
+	if retried.Load() {
+		t.Error("a consumed, unseekable body must not be retried")
+	}
+}
+
+func TestRequestRedirectCallback(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		w.Write([]byte("landed"))
+	}))
+	defer ts.Close()
+
+	var hops atomic.Int64
+	res, err := newClient().Get(ts.URL+"/old", &Options{
+		OnRedirect: func(req *http.Request, via []*http.Request) {
+			hops.Add(1)
+		},
+	})
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if string(res.Data()) != "landed" || hops.Load() != 1 {
+		t.Errorf("redirect not observed: data=%q hops=%d", res.Data(), hops.Load())
+	}
+}
+
+func TestRequestInterceptorCanAbort(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	client := newClient()
+
+	res, err := client.Get(ts.URL, &Options{
+		Interceptor: func(req *http.Request) error {
+			req.Header.Set("X-Token", "secret")
+			return nil
+		},
+	})
+	if err != nil || string(res.Data()) != "ok" {
+		t.Fatalf("interceptor header not applied: res=%v err=%v", res, err)
+	}
+
+	abort := errors.New("not today")
+	if _, err := client.Get(ts.URL, &Options{Interceptor: func(*http.Request) error { return abort }}); !errors.Is(err, abort) {
+		t.Errorf("interceptor error should abort the request, got %v", err)
+	}
+}
+
+func TestStreamDeliversHeadersBeforeBody(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Early", "yes")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("tail"))
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	res, err := newClient().Stream(context.Background(), http.MethodGet, ts.URL, nil)
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	defer res.Close()
+
+	// Headers are available while the body is still being produced.
+	if !res.OK() || res.Header.Get("X-Early") != "yes" {
+		t.Fatalf("headers not delivered early: status=%d", res.StatusCode)
+	}
+
+	release <- struct{}{}
+	body, err := io.ReadAll(res.Body)
+	if err != nil || string(body) != "tail" {
+		t.Errorf("body = %q, err = %v", body, err)
+	}
+}
+
+func TestStreamCancellationMidStream(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		w.Write([]byte("first chunk"))
+		w.(http.Flusher).Flush()
+		<-done // hold the rest of the body hostage
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	res, err := newClient().Stream(ctx, http.MethodGet, ts.URL, nil)
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	defer res.Close()
+
+	chunk := make([]byte, 16)
+	if _, err := res.Body.Read(chunk); err != nil {
+		t.Fatalf("reading the first chunk: %v", err)
+	}
+
+	cancel()
+
+	// The pending read must fail promptly with the cancellation, not hang
+	// until the server gives up.
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(res.Body)
+		readErr <- err
+	}()
+	select {
+	case err := <-readErr:
+		if err == nil {
+			t.Error("read after cancellation succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("read did not unblock after cancellation")
+	}
+}
+
+func TestPerRequestTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	start := time.Now()
+	_, err := newClient().Get(ts.URL, &Options{Timeout: 100 * time.Millisecond})
+	if err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("timeout took %v to fire", elapsed)
+	}
+}
+
+func TestClearCookies(t *testing.T) {
+	var lastCookies atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastCookies.Store(int64(len(r.Cookies())))
+		http.SetCookie(w, &http.Cookie{Name: "sticky", Value: "v", Path: "/"})
+	}))
+	defer ts.Close()
+
+	client := newClient()
+	if _, err := client.Get(ts.URL, nil); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+
+	res, err := client.Get(ts.URL, nil)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if lastCookies.Load() == 0 {
+		t.Fatal("jar did not replay the cookie")
+	}
+
+	client.ClearCookies(res.Request.URL)
+	if _, err := client.Get(ts.URL, nil); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if lastCookies.Load() != 0 {
+		t.Errorf("%d cookies survived ClearCookies", lastCookies.Load())
+	}
+}
+
+// decode reverses encode for the test's ordering checks.
+func decode(s string) uint64 {
+	var num uint64
+	for _, c := range []byte(s) {
+		num = num*uint64(len(alphabet)) + uint64(strings.IndexByte(alphabet, c))
+	}
+	return num
+}
+
+func TestCacheBusterStrings(t *testing.T) {
+	var prev uint64
+	for i := 0; i < 1000; i++ {
+		value := decode(MonotonicString())
+		if i > 0 && value <= prev {
+			t.Fatalf("MonotonicString not strictly increasing: %d then %d", prev, value)
+		}
+		prev = value
+	}
+
+	random := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		value := RandomString()
+		if random[value] {
+			t.Fatalf("RandomString repeated %q", value)
+		}
+		random[value] = true
+	}
+}